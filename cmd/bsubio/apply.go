@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bsubio/bsubio-go"
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest describes a set of jobs to run with "bsubio apply"
+type Manifest struct {
+	Jobs []ManifestEntry `json:"jobs" yaml:"jobs"`
+}
+
+// ManifestEntry is a single input to process. Relative paths are resolved
+// against the directory containing the manifest.
+type ManifestEntry struct {
+	Input  string `json:"input" yaml:"input"`
+	Type   string `json:"type" yaml:"type"`
+	Output string `json:"output" yaml:"output"`
+	Logs   string `json:"logs,omitempty" yaml:"logs,omitempty"`
+	Name   string `json:"name,omitempty" yaml:"name,omitempty"`
+	MIME   string `json:"mime,omitempty" yaml:"mime,omitempty"`
+}
+
+// key identifies an entry in the apply state file
+func (e ManifestEntry) key() string {
+	return e.Type + "|" + e.Input + "|" + e.Output
+}
+
+// applyState records the inputs that produced each output, so that
+// re-running a manifest can skip entries that are already up to date
+type applyState struct {
+	Entries map[string]applyStateEntry `json:"entries"`
+}
+
+type applyStateEntry struct {
+	InputSHA256 string    `json:"input_sha256"`
+	JobID       string    `json:"job_id"`
+	FinishedAt  time.Time `json:"finished_at"`
+}
+
+const applyStateFile = ".bsubio-apply.json"
+
+func runApply(args []string) error {
+	fs := flag.NewFlagSet("apply", flag.ContinueOnError)
+
+	// Define flags
+	force := fs.Bool("force", false, "Run every entry, even if its output is up to date")
+
+	// Custom usage function
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bsubio apply [options] <manifest>\n\n")
+		fmt.Fprintf(fs.Output(), "Run the jobs listed in a YAML or JSON manifest\n\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "\nArguments:\n")
+		fmt.Fprintf(fs.Output(), "  manifest    Path to the manifest file (e.g., jobs.yaml)\n")
+	}
+
+	// Parse flags
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	// Get remaining arguments
+	remainingArgs := fs.Args()
+	if len(remainingArgs) != 1 {
+		fs.Usage()
+		return usageErrorf("expected 1 argument, got %d", len(remainingArgs))
+	}
+
+	manifestPath := remainingArgs[0]
+
+	manifest, err := loadManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+
+	baseDir := filepath.Dir(manifestPath)
+	statePath := filepath.Join(baseDir, applyStateFile)
+
+	state, err := loadApplyState(statePath)
+	if err != nil {
+		return err
+	}
+
+	// Create client
+	client, err := createClient()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%-30s %-20s %-36s %s\n", "Input", "Type", "Job ID", "Result")
+	fmt.Println("--------------------------------------------------------------------------------")
+
+	var applied, skipped, failed int
+
+	for _, entry := range manifest.Jobs {
+		inputPath := resolvePath(baseDir, entry.Input)
+		outputPath := resolvePath(baseDir, entry.Output)
+
+		inputHash, err := hashFile(inputPath)
+		if err != nil {
+			failed++
+			fmt.Printf("%-30s %-20s %-36s %s\n", truncate(entry.Input, 30), entry.Type, "-", "error: "+err.Error())
+			continue
+		}
+
+		prev, ok := state.Entries[entry.key()]
+		if !*force && ok && prev.InputSHA256 == inputHash && fileExists(outputPath) {
+			skipped++
+			fmt.Printf("%-30s %-20s %-36s %s\n", truncate(entry.Input, 30), entry.Type, prev.JobID, "up to date")
+			continue
+		}
+
+		jobID, err := applyEntry(client, entry, baseDir)
+		if jobID == "" {
+			jobID = "-"
+		}
+		if err != nil {
+			failed++
+			fmt.Printf("%-30s %-20s %-36s %s\n", truncate(entry.Input, 30), entry.Type, jobID, "error: "+err.Error())
+			continue
+		}
+
+		applied++
+		fmt.Printf("%-30s %-20s %-36s %s\n", truncate(entry.Input, 30), entry.Type, jobID, "-> "+entry.Output)
+
+		state.Entries[entry.key()] = applyStateEntry{
+			InputSHA256: inputHash,
+			JobID:       jobID,
+			FinishedAt:  time.Now().UTC(),
+		}
+		if err := saveApplyState(statePath, state); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("--------------------------------------------------------------------------------")
+	fmt.Printf("Applied: %d, Up to date: %d, Failed: %d\n", applied, skipped, failed)
+
+	if failed > 0 {
+		return errorf(kindJobFailed, "%d of %d entries failed", failed, len(manifest.Jobs))
+	}
+
+	return nil
+}
+
+// applyEntry submits a manifest entry, waits for it and writes its output
+// and logs. It returns the job ID, if one was created, along with any error.
+func applyEntry(client *bsubio.BsubClient, entry ManifestEntry, baseDir string) (string, error) {
+	ctx := getContext()
+
+	job, err := submitFile(ctx, client, entry.Type, resolvePath(baseDir, entry.Input), entry.Name, entry.MIME)
+	if err != nil {
+		return "", err
+	}
+	jobID := job.Id.String()
+
+	finishedJob, err := waitForJob(ctx, client, *job.Id)
+	if err != nil {
+		return jobID, fmt.Errorf("failed to wait for job: %w", err)
+	}
+	recordJobStatus(finishedJob)
+
+	if entry.Logs != "" {
+		if err := writeJobLogs(ctx, client, *job.Id, resolvePath(baseDir, entry.Logs)); err != nil {
+			return jobID, err
+		}
+	}
+
+	if finishedJob.Status != nil && *finishedJob.Status == bsubio.JobStatusFailed {
+		return jobID, jobFailedError(*job.Id, finishedJob.ErrorMessage)
+	}
+
+	if err := writeJobOutput(ctx, client, *job.Id, resolvePath(baseDir, entry.Output)); err != nil {
+		return jobID, err
+	}
+
+	return jobID, nil
+}
+
+// loadManifest reads and validates a manifest file. Files ending in .json
+// are parsed as JSON, anything else as YAML.
+func loadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var manifest Manifest
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, &manifest)
+	} else {
+		err = yaml.Unmarshal(data, &manifest)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	if len(manifest.Jobs) == 0 {
+		return nil, fmt.Errorf("manifest %s has no jobs", path)
+	}
+
+	// Paths are compared once resolved, so that out/a.txt, ./out/a.txt and
+	// the same file given as an absolute path are told to be one
+	baseDir := filepath.Dir(path)
+	written := make(map[string]string)
+	for i, entry := range manifest.Jobs {
+		if entry.Input == "" || entry.Type == "" || entry.Output == "" {
+			return nil, fmt.Errorf("manifest entry %d: input, type and output are required", i+1)
+		}
+
+		for _, file := range []string{entry.Output, entry.Logs} {
+			if file == "" {
+				continue
+			}
+			key := resolvePath(baseDir, file)
+			if abs, err := filepath.Abs(key); err == nil {
+				key = abs
+			}
+			if other, ok := written[key]; ok {
+				if other == file {
+					return nil, fmt.Errorf("manifest entry %d: %s is written more than once", i+1, file)
+				}
+				return nil, fmt.Errorf("manifest entry %d: %s is written more than once (also as %s)", i+1, file, other)
+			}
+			written[key] = file
+		}
+	}
+
+	return &manifest, nil
+}
+
+func loadApplyState(path string) (*applyState, error) {
+	state := &applyState{Entries: make(map[string]applyStateEntry)}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to read apply state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse apply state %s: %w", path, err)
+	}
+	if state.Entries == nil {
+		state.Entries = make(map[string]applyStateEntry)
+	}
+
+	return state, nil
+}
+
+func saveApplyState(path string, state *applyState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal apply state: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write apply state: %w", err)
+	}
+
+	return nil
+}
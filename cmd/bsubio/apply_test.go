@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadManifestDuplicateOutputs(t *testing.T) {
+	dir := t.TempDir()
+	abs := filepath.Join(dir, "out", "a.txt")
+
+	tests := []struct {
+		name    string
+		jobs    string
+		wantErr bool
+	}{
+		{"distinct", `[{input: a.pdf, type: t, output: out/a.txt}, {input: b.pdf, type: t, output: out/b.txt}]`, false},
+		{"same string", `[{input: a.pdf, type: t, output: out/a.txt}, {input: b.pdf, type: t, output: out/a.txt}]`, true},
+		{"dot prefix", `[{input: a.pdf, type: t, output: out/a.txt}, {input: b.pdf, type: t, output: ./out/a.txt}]`, true},
+		{"parent dir", `[{input: a.pdf, type: t, output: out/a.txt}, {input: b.pdf, type: t, output: out/x/../a.txt}]`, true},
+		{"absolute", `[{input: a.pdf, type: t, output: out/a.txt}, {input: b.pdf, type: t, output: "` + filepath.ToSlash(abs) + `"}]`, true},
+		{"logs over output", `[{input: a.pdf, type: t, output: out/a.txt}, {input: b.pdf, type: t, output: out/b.txt, logs: out//a.txt}]`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "manifest.yaml")
+			if err := os.WriteFile(path, []byte("jobs: "+tt.jobs+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := loadManifest(path)
+			if tt.wantErr && err == nil {
+				t.Errorf("loadManifest() succeeded, want an error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("loadManifest() error = %v", err)
+			}
+		})
+	}
+}
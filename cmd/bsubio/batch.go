@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bsubio/bsubio-go"
+)
+
+// batchInput is a single file picked up by the batch command
+type batchInput struct {
+	Path string // path of the input file
+	Rel  string // path relative to the argument it was found under
+}
+
+type batchResult struct {
+	File     string
+	JobID    string
+	Status   string
+	Output   string
+	Error    string
+	Duration time.Duration
+}
+
+func runBatch(args []string) error {
+	fs := flag.NewFlagSet("batch", flag.ContinueOnError)
+
+	// Define flags
+	concurrency := fs.Int("concurrency", 4, "Number of jobs to run in parallel")
+	outDir := fs.String("out", "", "Output directory (default: next to each input file)")
+	recursive := fs.Bool("r", false, "Recurse into directories")
+	pattern := fs.String("pattern", "*", "File pattern to match inside directories (e.g., *.pdf)")
+
+	// Custom usage function
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bsubio batch [options] <type> <file|dir|glob>...\n\n")
+		fmt.Fprintf(fs.Output(), "Submit many files, wait for all of them and save their outputs\n\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "\nArguments:\n")
+		fmt.Fprintf(fs.Output(), "  type          Job type (e.g., pdf/extract)\n")
+		fmt.Fprintf(fs.Output(), "  file|dir|glob Input files, directories or glob patterns\n")
+	}
+
+	// Parse flags
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	// Get remaining arguments
+	remainingArgs := fs.Args()
+	if len(remainingArgs) < 2 {
+		fs.Usage()
+		return usageErrorf("expected at least 2 arguments, got %d", len(remainingArgs))
+	}
+
+	if *concurrency < 1 {
+		return usageErrorf("concurrency must be at least 1")
+	}
+
+	if _, err := filepath.Match(*pattern, ""); err != nil {
+		return usageErrorf("invalid pattern %q: %w", *pattern, err)
+	}
+
+	jobType := remainingArgs[0]
+
+	inputs, err := expandBatchInputs(remainingArgs[1:], *pattern, *recursive)
+	if err != nil {
+		return err
+	}
+
+	if len(inputs) == 0 {
+		return fmt.Errorf("no input files found")
+	}
+
+	// Create client
+	client, err := createClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := getContext()
+
+	ext := outputExtension(ctx, client, jobType)
+
+	outPaths, err := batchOutputPaths(inputs, *outDir, ext)
+	if err != nil {
+		return err
+	}
+
+	if *outDir != "" {
+		if err := os.MkdirAll(*outDir, 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Processing %d file(s) with job type %s (concurrency %d)\n", len(inputs), jobType, *concurrency)
+
+	results := processBatchInputs(ctx, client, jobType, inputs, outPaths, *concurrency)
+
+	// Print summary
+	fmt.Println("================================================================================")
+	fmt.Println("SUMMARY")
+	fmt.Println("================================================================================")
+	fmt.Printf("%-30s %-36s %-10s %8s %s\n", "File", "Job ID", "Status", "Time (s)", "Output")
+	fmt.Println("--------------------------------------------------------------------------------")
+
+	for _, r := range results {
+		detail := r.Output
+		if r.Error != "" {
+			detail = r.Error
+		}
+
+		jobID := r.JobID
+		if jobID == "" {
+			jobID = "-"
+		}
+
+		fmt.Printf("%-30s %-36s %-10s %8.2f %s\n",
+			truncate(r.File, 30),
+			jobID,
+			r.Status,
+			r.Duration.Seconds(),
+			detail)
+	}
+
+	fmt.Println("--------------------------------------------------------------------------------")
+	fmt.Printf("Successful: %d/%d\n", countBatchResults(results, "finished"), len(results))
+
+	return batchError(ctx, results)
+}
+
+// processBatchInputs runs the inputs on concurrency workers. Once ctx is
+// done, no more inputs are submitted; those left out keep the "skipped"
+// status.
+func processBatchInputs(ctx context.Context, client *bsubio.BsubClient, jobType string, inputs []batchInput, outPaths []string, concurrency int) []batchResult {
+	results := make([]batchResult, len(inputs))
+	for i, in := range inputs {
+		results[i] = batchResult{File: in.Path, Status: "skipped", Error: "not submitted"}
+	}
+
+	work := make(chan int)
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		done int
+	)
+
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				in := inputs[i]
+				results[i] = processBatchInput(ctx, client, jobType, in, outPaths[i])
+
+				mu.Lock()
+				done++
+				fmt.Fprintf(os.Stderr, "[%d/%d] %s: %s\n", done, len(inputs), in.Path, results[i].Status)
+				mu.Unlock()
+			}
+		}()
+	}
+
+dispatch:
+	for i := range inputs {
+		// Checked first, as select picks at random when a worker is ready too
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case work <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	return results
+}
+
+// countBatchResults returns the number of results with the given status
+func countBatchResults(results []batchResult, status string) int {
+	n := 0
+	for _, r := range results {
+		if r.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// batchError returns the error the batch command ends with: the cause of
+// ctx when it was interrupted or timed out, so that the exit code tells so,
+// or a job_failed error when any job did not finish
+func batchError(ctx context.Context, results []batchResult) error {
+	finished := countBatchResults(results, "finished")
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("batch stopped with %d of %d file(s) processed and %d not submitted: %w",
+			finished, len(results), countBatchResults(results, "skipped"), context.Cause(ctx))
+	}
+
+	if failed := len(results) - finished; failed > 0 {
+		return errorf(kindJobFailed, "%d of %d job(s) failed", failed, len(results))
+	}
+
+	return nil
+}
+
+// processBatchInput submits a single file, waits for it and saves its output
+func processBatchInput(ctx context.Context, client *bsubio.BsubClient, jobType string, in batchInput, outPath string) batchResult {
+	start := time.Now()
+
+	result := batchResult{
+		File:   in.Path,
+		Status: "error",
+	}
+
+	fail := func(status string, err error) batchResult {
+		if ctx.Err() != nil {
+			status = "interrupted"
+		}
+		result.Status = status
+		result.Error = err.Error()
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	job, err := submitFile(ctx, client, jobType, in.Path, "", "")
+	if err != nil {
+		return fail("submit_failed", err)
+	}
+	result.JobID = job.Id.String()
+
+	finishedJob, err := waitForJob(ctx, client, *job.Id)
+	if err != nil {
+		return fail("wait_failed", err)
+	}
+	recordJobStatus(finishedJob)
+
+	if finishedJob.Status != nil && *finishedJob.Status == bsubio.JobStatusFailed {
+		return fail("failed", jobFailedError(*job.Id, finishedJob.ErrorMessage))
+	}
+
+	if err := writeJobOutput(ctx, client, *job.Id, outPath); err != nil {
+		return fail("output_failed", err)
+	}
+
+	result.Status = "finished"
+	result.Output = outPath
+	result.Duration = time.Since(start)
+	return result
+}
+
+// expandBatchInputs turns files, directories and glob patterns into a list of input files
+func expandBatchInputs(args []string, pattern string, recursive bool) ([]batchInput, error) {
+	var inputs []batchInput
+	seen := make(map[string]bool)
+
+	add := func(path, rel string) {
+		if seen[path] {
+			return
+		}
+		seen[path] = true
+		inputs = append(inputs, batchInput{Path: path, Rel: rel})
+	}
+
+	for _, arg := range args {
+		paths := []string{arg}
+		if strings.ContainsAny(arg, "*?[") {
+			matches, err := filepath.Glob(arg)
+			if err != nil {
+				return nil, fmt.Errorf("invalid glob %q: %w", arg, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match %s", arg)
+			}
+			paths = matches
+		}
+
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil, fmt.Errorf("input file not found: %s", path)
+				}
+				return nil, fmt.Errorf("failed to access input file: %w", err)
+			}
+
+			if !info.IsDir() {
+				add(path, filepath.Base(path))
+				continue
+			}
+
+			err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.IsDir() {
+					if p != path && (!recursive || strings.HasPrefix(d.Name(), ".")) {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if strings.HasPrefix(d.Name(), ".") || !d.Type().IsRegular() {
+					return nil
+				}
+				if ok, _ := filepath.Match(pattern, d.Name()); !ok {
+					return nil
+				}
+				rel, err := filepath.Rel(path, p)
+				if err != nil {
+					return err
+				}
+				add(p, rel)
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to scan directory %s: %w", path, err)
+			}
+		}
+	}
+
+	return inputs, nil
+}
+
+// batchOutputPath returns where the output for an input file should be written
+func batchOutputPath(in batchInput, outDir, ext string) string {
+	rel := strings.TrimSuffix(in.Rel, filepath.Ext(in.Rel)) + "." + ext
+
+	if outDir != "" {
+		return filepath.Join(outDir, rel)
+	}
+
+	outPath := filepath.Join(filepath.Dir(in.Path), filepath.Base(rel))
+	if outPath == in.Path {
+		outPath = in.Path + ".out"
+	}
+	return outPath
+}
+
+// batchOutputPaths returns the output path of every input, refusing inputs
+// whose outputs would overwrite each other, like a/x.pdf and b/x.pdf with
+// --out, or x.pdf and x.docx next to each other
+func batchOutputPaths(inputs []batchInput, outDir, ext string) ([]string, error) {
+	paths := make([]string, len(inputs))
+	owners := make(map[string]string, len(inputs))
+	for i, in := range inputs {
+		paths[i] = batchOutputPath(in, outDir, ext)
+
+		key := filepath.Clean(paths[i])
+		if abs, err := filepath.Abs(key); err == nil {
+			key = abs
+		}
+		if other, ok := owners[key]; ok {
+			return nil, fmt.Errorf("%s and %s would both be saved to %s\nProcess them in separate batches or with different --out directories",
+				other, in.Path, paths[i])
+		}
+		owners[key] = in.Path
+	}
+	return paths, nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bsubio/bsubio-go"
+	"github.com/google/uuid"
+)
+
+func TestBatchOutputPaths(t *testing.T) {
+	tests := []struct {
+		name    string
+		inputs  []batchInput
+		outDir  string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:   "next to inputs",
+			inputs: []batchInput{{"a/x.pdf", "x.pdf"}, {"b/x.pdf", "x.pdf"}},
+			want:   []string{filepath.Join("a", "x.txt"), filepath.Join("b", "x.txt")},
+		},
+		{
+			name:   "directory layout kept",
+			inputs: []batchInput{{"in/a/x.pdf", filepath.Join("a", "x.pdf")}, {"in/b/x.pdf", filepath.Join("b", "x.pdf")}},
+			outDir: "res",
+			want:   []string{filepath.Join("res", "a", "x.txt"), filepath.Join("res", "b", "x.txt")},
+		},
+		{
+			name:    "same file name in output directory",
+			inputs:  []batchInput{{"a/x.pdf", "x.pdf"}, {"b/x.pdf", "x.pdf"}},
+			outDir:  "res",
+			wantErr: true,
+		},
+		{
+			name:    "same base name next to inputs",
+			inputs:  []batchInput{{"a/x.pdf", "x.pdf"}, {"a/x.docx", "x.docx"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := batchOutputPaths(tt.inputs, tt.outDir, "txt")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("batchOutputPaths() = %v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("batchOutputPaths() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("batchOutputPaths() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatchInterrupted(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The second job is interrupted while it is being submitted
+	var created atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		id := uuid.New()
+		switch {
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/jobs"):
+			if created.Add(1) == 2 {
+				cancel()
+			}
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"success": true, "data": {"id": %q, "upload_token": "token", "status": "created"}}`, id)
+		case strings.Contains(r.URL.Path, "/upload/"):
+			_, _ = fmt.Fprint(w, `{"success": true}`)
+		case strings.HasSuffix(r.URL.Path, "/submit"):
+			_, _ = fmt.Fprint(w, `{"success": true}`)
+		case strings.HasSuffix(r.URL.Path, "/output"):
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = fmt.Fprint(w, "output")
+		default:
+			fmt.Fprintf(w, `{"success": true, "data": {"id": %q, "status": "finished"}}`, id)
+		}
+	}))
+	defer srv.Close()
+
+	client, err := bsubio.NewBsubClient(bsubio.Config{APIKey: "test", BaseURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	var inputs []batchInput
+	var outPaths []string
+	for i := range 4 {
+		path := filepath.Join(dir, fmt.Sprintf("in%d.txt", i))
+		if err := os.WriteFile(path, []byte("input"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, batchInput{path, filepath.Base(path)})
+		outPaths = append(outPaths, path+".out")
+	}
+
+	results := processBatchInputs(ctx, client, "passthru", inputs, outPaths, 1)
+
+	var statuses []string
+	for _, r := range results {
+		statuses = append(statuses, r.Status)
+	}
+	if want := []string{"finished", "interrupted", "skipped", "skipped"}; !reflect.DeepEqual(statuses, want) {
+		t.Fatalf("statuses = %v, want %v", statuses, want)
+	}
+	for i, r := range results {
+		if r.File != inputs[i].Path {
+			t.Errorf("result %d is for %q, want %q", i, r.File, inputs[i].Path)
+		}
+	}
+
+	err = batchError(ctx, results)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("batchError() = %v, want the context's cancellation", err)
+	}
+}
@@ -9,6 +9,11 @@ import (
 	"time"
 )
 
+// benchPollInterval is how often bench polls its jobs. It is short and
+// fixed, rather than backing off, so that the measured times are off by at
+// most that much.
+const benchPollInterval = 250 * time.Millisecond
+
 func runBench(args []string) error {
 	// Check if this is a diff subcommand
 	if len(args) > 0 && args[0] == "diff" {
@@ -21,7 +26,9 @@ func runBench(args []string) error {
 	jobType := fs.String("type", "pdf_extract", "Job type to use for benchmarking")
 	dataDir := fs.String("dir", "tests/data", "Directory containing test files")
 	pattern := fs.String("pattern", "*.pdf", "File pattern to match (e.g., *.pdf)")
-	jsonOutput := fs.Bool("json", false, "Output results in JSON format")
+	jsonOut := fs.Bool("json", false, "Same as --output json")
+	noCache := fs.Bool("no-cache", false, "Do not use the local result cache")
+	out := addOutputFlags(fs)
 
 	// Custom usage function
 	fs.Usage = func() {
@@ -33,9 +40,21 @@ func runBench(args []string) error {
 
 	// Parse flags
 	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	if err := applyJSONFlag(out, *jsonOut); err != nil {
+		return err
+	}
+
+	if err := out.check(); err != nil {
 		return err
 	}
 
+	// Progress is only printed along with the summary table, so that
+	// structured output can be piped
+	quiet := !out.table()
+
 	// Check if data directory exists
 	if _, err := os.Stat(*dataDir); err != nil {
 		if os.IsNotExist(err) {
@@ -62,7 +81,9 @@ func runBench(args []string) error {
 
 	ctx := getContext()
 
-	if !*jsonOutput {
+	cache, version := openCacheForServer(ctx, client, *noCache)
+
+	if !quiet {
 		fmt.Printf("Benchmarking %d file(s) with job type: %s\n", len(testFiles), *jobType)
 		fmt.Println("================================================================================")
 	}
@@ -81,13 +102,34 @@ func runBench(args []string) error {
 			continue
 		}
 
-		if !*jsonOutput {
+		if !quiet {
 			fmt.Printf("\nProcessing: %s (%d bytes)\n", filepath.Base(testFile), fileInfo.Size())
 		}
 
+		// Skip files whose output is already in the result cache
+		var entry cacheEntry
+		if cache != nil {
+			entry, err = entryForFile(testFile, *jobType, version)
+			if err == nil {
+				if hit, _, ok := cache.lookup(entry.Key); ok {
+					results = append(results, benchResult{
+						File:   filepath.Base(testFile),
+						Size:   fileInfo.Size(),
+						JobID:  hit.JobID,
+						Status: "finished",
+						Cached: true,
+					})
+					if !quiet {
+						fmt.Printf("  Cached: output of job %s\n", hit.JobID)
+					}
+					continue
+				}
+			}
+		}
+
 		// Time submission
 		submitStart := time.Now()
-		job, err := client.CreateAndSubmitJobFromFile(ctx, *jobType, testFile)
+		job, err := submitFile(ctx, client, *jobType, testFile, "", "")
 		submitDuration := time.Since(submitStart)
 
 		if err != nil {
@@ -97,19 +139,19 @@ func runBench(args []string) error {
 				Status: "submit_failed",
 				Error:  err.Error(),
 			})
-			if !*jsonOutput {
+			if !quiet {
 				fmt.Printf("  Submit failed: %v\n", err)
 			}
 			continue
 		}
 
-		if !*jsonOutput {
+		if !quiet {
 			fmt.Printf("  Job ID: %s\n", job.Id.String())
 			fmt.Printf("  Submit time: %.2fs\n", float64(submitDuration.Milliseconds())/1000.0)
 		}
 
 		// Wait for completion
-		finishedJob, err := client.WaitForJob(ctx, *job.Id)
+		finishedJob, err := pollJob(ctx, client, *job.Id, newPollBackoff(pollClock, benchPollInterval, benchPollInterval))
 		totalDuration := time.Since(submitStart)
 
 		if err != nil {
@@ -121,12 +163,14 @@ func runBench(args []string) error {
 				Status:   "wait_failed",
 				Error:    err.Error(),
 			})
-			if !*jsonOutput {
+			if !quiet {
 				fmt.Printf("  Wait failed: %v\n", err)
 			}
 			continue
 		}
 
+		recordJobStatus(finishedJob)
+
 		jobStatus := "unknown"
 		if finishedJob.Status != nil {
 			jobStatus = string(*finishedJob.Status)
@@ -147,7 +191,17 @@ func runBench(args []string) error {
 			Error:    errorMsg,
 		})
 
-		if !*jsonOutput {
+		if cache != nil && entry.Key != "" && jobStatus == "finished" {
+			path, cached, err := cache.storeJobOutput(ctx, client, *job.Id, entry, false)
+			if err != nil && !quiet {
+				fmt.Printf("  Warning: failed to cache output: %v\n", err)
+			}
+			if err == nil && !cached {
+				_ = os.Remove(path)
+			}
+		}
+
+		if !quiet {
 			fmt.Printf("  Status: %s\n", jobStatus)
 			fmt.Printf("  Total time: %.2fs\n", float64(totalDuration.Milliseconds())/1000.0)
 
@@ -158,26 +212,30 @@ func runBench(args []string) error {
 	}
 
 	// Output results
-	if *jsonOutput {
-		// JSON output
-
+	if !out.table() {
 		var totalSubmitMs int64
 		var totalProcessMs int64
 		successCount := 0
+		timedCount := len(results)
 
 		for _, r := range results {
-			totalSubmitMs += r.SubmitMs
-			totalProcessMs += r.TotalMs
 			if r.Status == "finished" || r.Status == "completed" {
 				successCount++
 			}
+			// Cached results were not processed, so they don't count towards timings
+			if r.Cached {
+				timedCount--
+				continue
+			}
+			totalSubmitMs += r.SubmitMs
+			totalProcessMs += r.TotalMs
 		}
 
 		avgSubmitMs := int64(0)
 		avgTotalMs := int64(0)
-		if len(results) > 0 {
-			avgSubmitMs = totalSubmitMs / int64(len(results))
-			avgTotalMs = totalProcessMs / int64(len(results))
+		if timedCount > 0 {
+			avgSubmitMs = totalSubmitMs / int64(timedCount)
+			avgTotalMs = totalProcessMs / int64(timedCount)
 		}
 
 		output := benchOutput{
@@ -189,54 +247,65 @@ func runBench(args []string) error {
 			Results:     results,
 		}
 
-		encoder := json.NewEncoder(os.Stdout)
-		encoder.SetIndent("", "  ")
-		if err := encoder.Encode(output); err != nil {
-			return fmt.Errorf("failed to encode JSON output: %w", err)
+		// JSON and YAML hold the whole run, which bench diff reads back;
+		// the other formats list the results
+		if out.tmpl == nil && (out.Format == outputJSON || out.Format == outputYAML) {
+			return printItem(out, output, nil)
 		}
-	} else {
-		// Text output
-		fmt.Println("\n================================================================================")
-		fmt.Println("SUMMARY")
-		fmt.Println("================================================================================")
-		fmt.Printf("%-30s %10s %10s %10s %s\n", "File", "Size", "Submit (s)", "Total (s)", "Status")
-		fmt.Println("--------------------------------------------------------------------------------")
+		return printList(out, results, benchColumns)
+	}
 
-		var totalSubmitMs int64
-		var totalProcessMs int64
-		successCount := 0
+	// Text output
+	fmt.Println("\n================================================================================")
+	fmt.Println("SUMMARY")
+	fmt.Println("================================================================================")
+	fmt.Printf("%-30s %10s %10s %10s %s\n", "File", "Size", "Submit (s)", "Total (s)", "Status")
+	fmt.Println("--------------------------------------------------------------------------------")
+
+	var totalSubmitMs int64
+	var totalProcessMs int64
+	successCount := 0
+	timedCount := len(results)
+
+	for _, r := range results {
+		if r.Cached {
+			timedCount--
+			fmt.Printf("%-30s %10s %10s %10s %s (cached)\n",
+				truncate(r.File, 30),
+				formatBytes(r.Size),
+				"-",
+				"-",
+				r.Status)
+			successCount++
+		} else if r.Error != "" {
+			fmt.Printf("%-30s %10s %10s %10s %s: %s\n",
+				truncate(r.File, 30),
+				formatBytes(r.Size),
+				"-",
+				"-",
+				r.Status,
+				r.Error)
+		} else {
+			fmt.Printf("%-30s %10s %10.2f %10.2f %s\n",
+				truncate(r.File, 30),
+				formatBytes(r.Size),
+				float64(r.SubmitMs)/1000.0,
+				float64(r.TotalMs)/1000.0,
+				r.Status)
 
-		for _, r := range results {
-			if r.Error != "" {
-				fmt.Printf("%-30s %10s %10s %10s %s: %s\n",
-					truncate(r.File, 30),
-					formatBytes(r.Size),
-					"-",
-					"-",
-					r.Status,
-					r.Error)
-			} else {
-				fmt.Printf("%-30s %10s %10.2f %10.2f %s\n",
-					truncate(r.File, 30),
-					formatBytes(r.Size),
-					float64(r.SubmitMs)/1000.0,
-					float64(r.TotalMs)/1000.0,
-					r.Status)
-
-				totalSubmitMs += r.SubmitMs
-				totalProcessMs += r.TotalMs
-				if r.Status == "finished" || r.Status == "completed" {
-					successCount++
-				}
+			totalSubmitMs += r.SubmitMs
+			totalProcessMs += r.TotalMs
+			if r.Status == "finished" || r.Status == "completed" {
+				successCount++
 			}
 		}
+	}
 
-		fmt.Println("--------------------------------------------------------------------------------")
-		fmt.Printf("Successful: %d/%d\n", successCount, len(results))
-		if len(results) > 0 {
-			fmt.Printf("Avg Submit: %.2fs\n", float64(totalSubmitMs)/1000.0/float64(len(results)))
-			fmt.Printf("Avg Total:  %.2fs\n", float64(totalProcessMs)/1000.0/float64(len(results)))
-		}
+	fmt.Println("--------------------------------------------------------------------------------")
+	fmt.Printf("Successful: %d/%d\n", successCount, len(results))
+	if timedCount > 0 {
+		fmt.Printf("Avg Submit: %.2fs\n", float64(totalSubmitMs)/1000.0/float64(timedCount))
+		fmt.Printf("Avg Total:  %.2fs\n", float64(totalProcessMs)/1000.0/float64(timedCount))
 	}
 
 	return nil
@@ -270,6 +339,18 @@ type benchResult struct {
 	TotalMs  int64  `json:"total_ms"`
 	Status   string `json:"status"`
 	Error    string `json:"error,omitempty"`
+	Cached   bool   `json:"cached,omitempty"`
+}
+
+var benchColumns = []outputColumn[benchResult]{
+	{"file", func(r benchResult) string { return r.File }},
+	{"size", func(r benchResult) string { return fmt.Sprint(r.Size) }},
+	{"job_id", func(r benchResult) string { return r.JobID }},
+	{"submit_ms", func(r benchResult) string { return fmt.Sprint(r.SubmitMs) }},
+	{"total_ms", func(r benchResult) string { return fmt.Sprint(r.TotalMs) }},
+	{"status", func(r benchResult) string { return r.Status }},
+	{"error", func(r benchResult) string { return r.Error }},
+	{"cached", func(r benchResult) string { return fmt.Sprint(r.Cached) }},
 }
 
 type benchOutput struct {
@@ -283,7 +364,7 @@ type benchOutput struct {
 
 func runBenchDiff(args []string) error {
 	if len(args) < 2 {
-		return fmt.Errorf("usage: bsubio bench diff <file1.json> <file2.json>")
+		return usageErrorf("usage: bsubio bench diff <file1.json> <file2.json>")
 	}
 
 	file1Path := args[0]
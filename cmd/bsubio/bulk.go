@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bsubio/bsubio-go"
+	"golang.org/x/term"
+)
+
+// cancel and rm act on jobs given by ID or selected with filters. When more
+// than bulkConfirmThreshold jobs are selected, they ask for confirmation
+// first, unless --yes is given.
+const bulkConfirmThreshold = 10
+
+// bulkConfirmShown is how many of the jobs are listed when asking
+const bulkConfirmShown = 20
+
+// bulkAction is what cancel or rm does to each selected job
+type bulkAction struct {
+	Verb string // e.g., "cancel"
+	Done string // e.g., "Canceled"
+
+	// Applies reports whether a listed job can be acted on
+	Applies func(job *bsubio.Job) bool
+
+	// Run acts on a single job
+	Run func(ctx context.Context, client *bsubio.BsubClient, jobID bsubio.JobId) error
+}
+
+// bulkOptions holds the flags selecting the jobs of a bulk action
+type bulkOptions struct {
+	All           bool
+	Status        string
+	Type          string
+	OlderThan     string
+	CreatedBefore string
+	DryRun        bool
+	Yes           bool
+	Concurrency   int
+}
+
+// addBulkFlags registers the flags of a bulk action
+func addBulkFlags(fs *flag.FlagSet, action *bulkAction) *bulkOptions {
+	o := &bulkOptions{}
+	fs.BoolVar(&o.All, "a", false, fmt.Sprintf("%s all jobs matching the filters (all jobs without filters)", capitalize(action.Verb)))
+	fs.BoolVar(&o.All, "all", false, "Same as -a")
+	fs.StringVar(&o.Status, "status", "", fmt.Sprintf("Only %s jobs with this status", action.Verb))
+	fs.StringVar(&o.Type, "type", "", fmt.Sprintf("Only %s jobs of this type", action.Verb))
+	fs.StringVar(&o.OlderThan, "older-than", "", fmt.Sprintf("Only %s jobs created longer ago than this (e.g., 12h, 7d)", action.Verb))
+	fs.StringVar(&o.CreatedBefore, "created-before", "", fmt.Sprintf("Only %s jobs created before this time (e.g., 2025-01-31)", action.Verb))
+	fs.BoolVar(&o.DryRun, "dry-run", false, fmt.Sprintf("List the jobs that would be %s without changing anything", strings.ToLower(action.Done)))
+	fs.BoolVar(&o.Yes, "yes", false, "Do not ask for confirmation")
+	fs.BoolVar(&o.Yes, "y", false, "Same as --yes")
+	fs.IntVar(&o.Concurrency, "concurrency", 4, fmt.Sprintf("Number of jobs to %s in parallel", action.Verb))
+	return o
+}
+
+// filtered reports whether any filter is set
+func (o *bulkOptions) filtered() bool {
+	return o.Status != "" || o.Type != "" || o.OlderThan != "" || o.CreatedBefore != ""
+}
+
+// filter returns the job filter the flags describe
+func (o *bulkOptions) filter(now time.Time) (jobFilter, error) {
+	f := jobFilter{Status: o.Status, Type: o.Type}
+
+	if o.OlderThan != "" {
+		age, err := parseAge(o.OlderThan)
+		if err != nil {
+			return f, usageErrorf("invalid --older-than: %w", err)
+		}
+		f.Until = now.Add(-age)
+	}
+
+	if o.CreatedBefore != "" {
+		before, err := parseTimeArg(o.CreatedBefore, now)
+		if err != nil {
+			return f, usageErrorf("invalid --created-before: %w", err)
+		}
+		if f.Until.IsZero() || before.Before(f.Until) {
+			f.Until = before
+		}
+	}
+
+	return f, nil
+}
+
+// runBulk runs an action on the jobs given as arguments (or on stdin with
+// "-"), or on the jobs selected by the filters with -a
+func runBulk(fs *flag.FlagSet, o *bulkOptions, action *bulkAction) error {
+	args := fs.Args()
+
+	if o.Concurrency < 1 {
+		return usageErrorf("concurrency must be at least 1")
+	}
+
+	selecting := o.All || o.filtered()
+	switch {
+	case selecting && len(args) > 0:
+		return usageErrorf("job IDs cannot be combined with -a or filters")
+	case !selecting && len(args) == 0:
+		fs.Usage()
+		return usageErrorf("expected job IDs, -a or filters")
+	}
+
+	var ids []string
+	for _, arg := range args {
+		if arg != "-" {
+			ids = append(ids, arg)
+			continue
+		}
+		stdinIDs, err := readJobIDs(os.Stdin)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, stdinIDs...)
+	}
+
+	if len(args) > 0 && len(ids) == 0 {
+		return usageErrorf("no job IDs given")
+	}
+
+	filter, err := o.filter(time.Now())
+	if err != nil {
+		return err
+	}
+
+	// Create client
+	client, err := createClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := getContext()
+
+	// Listed jobs are shown with their details; given IDs only by ID
+	var (
+		jobIDs  []bsubio.JobId
+		listed  []bsubio.Job
+		listErr error
+	)
+	if selecting {
+		jobs, err := listJobs(ctx, client, filter, 0)
+		if err != nil && classifyError(err) != kindIncomplete {
+			return err
+		}
+
+		// When older jobs are out of reach, the listed ones are acted on
+		// and the command fails, saying jobs were left out
+		if err != nil {
+			listErr = errorf(kindIncomplete, "%v, so they were left out", err)
+		}
+		for _, job := range jobs {
+			if job.Id != nil && action.Applies(&job) {
+				jobIDs = append(jobIDs, *job.Id)
+				listed = append(listed, job)
+			}
+		}
+	} else {
+		jobIDs, err = resolveJobIDs(ctx, client, ids)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(jobIDs) == 0 {
+		fmt.Fprintf(os.Stderr, "No jobs to %s\n", action.Verb)
+		return listErr
+	}
+
+	if o.DryRun {
+		fmt.Fprintf(os.Stderr, "Would %s %d job(s):\n", action.Verb, len(jobIDs))
+		printBulkJobs(os.Stdout, jobIDs, listed, 0)
+		return listErr
+	}
+
+	// A single job given by ID keeps the command's plain behaviour, and
+	// its error
+	if !selecting && len(jobIDs) == 1 {
+		if err := action.Run(ctx, client, jobIDs[0]); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Job %s: %s\n", strings.ToLower(action.Done), jobIDs[0])
+		return nil
+	}
+
+	if len(jobIDs) > bulkConfirmThreshold && !o.Yes {
+		if err := confirmBulk(action, jobIDs, listed, containsStdin(args)); err != nil {
+			return err
+		}
+	}
+
+	if err := runBulkWorkers(ctx, client, action, jobIDs, o.Concurrency); err != nil {
+		return err
+	}
+
+	return listErr
+}
+
+// runBulkWorkers runs an action on jobs with a pool of workers
+func runBulkWorkers(ctx context.Context, client *bsubio.BsubClient, action *bulkAction, jobIDs []bsubio.JobId, concurrency int) error {
+	work := make(chan bsubio.JobId)
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		done   int
+		failed int
+	)
+
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range work {
+				err := action.Run(ctx, client, id)
+
+				mu.Lock()
+				if err != nil {
+					failed++
+					fmt.Fprintf(os.Stderr, "Failed to %s job %s: %v\n", action.Verb, id, err)
+				} else {
+					done++
+					fmt.Fprintf(os.Stderr, "%s job: %s\n", action.Done, id)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, id := range jobIDs {
+		select {
+		case work <- id:
+		case <-ctx.Done():
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "%s %d job(s)\n", action.Done, done)
+
+	if failed > 0 {
+		return fmt.Errorf("failed to %s %d of %d job(s)", action.Verb, failed, len(jobIDs))
+	}
+
+	return nil
+}
+
+// confirmBulk asks before acting on many jobs. Without a terminal to ask
+// on, or when stdin holds the job IDs, --yes is required.
+func confirmBulk(action *bulkAction, jobIDs []bsubio.JobId, listed []bsubio.Job, idsOnStdin bool) error {
+	if idsOnStdin || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return usageErrorf("refusing to %s %d jobs without --yes (use --dry-run to list them)", action.Verb, len(jobIDs))
+	}
+
+	fmt.Fprintf(os.Stderr, "About to %s %d job(s):\n", action.Verb, len(jobIDs))
+	printBulkJobs(os.Stderr, jobIDs, listed, bulkConfirmShown)
+	fmt.Fprintf(os.Stderr, "%s %d job(s)? [y/N] ", capitalize(action.Verb), len(jobIDs))
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		fmt.Fprintln(os.Stderr)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+
+	return fmt.Errorf("aborted")
+}
+
+// printBulkJobs lists the jobs of a bulk action, with their details when
+// they were listed, and at most limit of them unless limit is 0
+func printBulkJobs(w io.Writer, jobIDs []bsubio.JobId, listed []bsubio.Job, limit int) {
+	for i, id := range jobIDs {
+		if limit > 0 && i == limit {
+			fmt.Fprintf(w, "... and %d more\n", len(jobIDs)-limit)
+			return
+		}
+
+		if len(listed) == 0 {
+			fmt.Fprintln(w, id)
+			continue
+		}
+
+		job := listed[i]
+		createdAt := ""
+		if job.CreatedAt != nil {
+			createdAt = job.CreatedAt.Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(w, "%-36s  %-10s  %-16s  %s\n", id, derefStatus(job.Status), createdAt, derefString(job.Type))
+	}
+}
+
+// containsStdin reports whether "-" is among the arguments
+func containsStdin(args []string) bool {
+	for _, arg := range args {
+		if arg == "-" {
+			return true
+		}
+	}
+	return false
+}
+
+// capitalize upper-cases the first letter of s
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBulkOptionsFilter(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		opts bulkOptions
+		want time.Time
+	}{
+		{bulkOptions{Status: "failed"}, time.Time{}},
+		{bulkOptions{OlderThan: "7d"}, now.Add(-7 * 24 * time.Hour)},
+		{bulkOptions{CreatedBefore: "2025-03-01T00:00:00Z"}, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)},
+		// Both limits apply, so the earlier one wins
+		{bulkOptions{OlderThan: "2h", CreatedBefore: "2025-03-01T00:00:00Z"}, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{bulkOptions{OlderThan: "30d", CreatedBefore: "2025-03-01T00:00:00Z"}, now.Add(-30 * 24 * time.Hour)},
+	}
+
+	for _, tt := range tests {
+		f, err := tt.opts.filter(now)
+		if err != nil {
+			t.Errorf("filter(%+v): %v", tt.opts, err)
+			continue
+		}
+		if !f.Until.Equal(tt.want) {
+			t.Errorf("filter(%+v).Until = %v, want %v", tt.opts, f.Until, tt.want)
+		}
+	}
+
+	// --older-than takes durations only
+	if _, err := (&bulkOptions{OlderThan: "2025-03-01"}).filter(now); err == nil {
+		t.Errorf("filter with a date as --older-than succeeded, want an error")
+	}
+}
@@ -0,0 +1,731 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bsubio/bsubio-go"
+)
+
+// defaultCacheMaxSize is used when the config does not set cache_max_size
+const defaultCacheMaxSize = 1 << 30 // 1 GiB
+
+// cacheLockTimeout is how long to wait for another process to finish
+// updating the cache index
+const cacheLockTimeout = 10 * time.Second
+
+// cacheLockStale is the age after which a lock file is assumed to be left
+// over by a process that crashed while holding it
+const cacheLockStale = time.Minute
+
+// errCacheIndexCorrupt is returned when the cache index cannot be parsed
+var errCacheIndexCorrupt = errors.New("cache index is corrupt")
+
+// resultCache stores job outputs on disk, keyed by the SHA-256 of the input,
+// the job type and the server version, so identical inputs are not
+// processed twice. Least recently used entries are evicted once the cache
+// grows beyond maxSize.
+type resultCache struct {
+	dir     string
+	maxSize int64
+
+	mu    sync.Mutex
+	index map[string]*cacheEntry
+
+	// removed holds the keys removed since the index was last saved, so
+	// saving does not bring them back from the copy on disk
+	removed map[string]bool
+}
+
+// cacheEntry describes a cached job output
+type cacheEntry struct {
+	Key           string    `json:"key"`
+	JobID         string    `json:"job_id"`
+	Type          string    `json:"type"`
+	InputSHA256   string    `json:"input_sha256"`
+	ServerVersion string    `json:"server_version"`
+	Size          int64     `json:"size"`
+	CreatedAt     time.Time `json:"created_at"`
+	LastUsed      time.Time `json:"last_used"`
+}
+
+// getCacheDir returns the directory holding the result cache
+func getCacheDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get cache directory: %w", err)
+	}
+
+	return filepath.Join(cacheDir, "bsubio"), nil
+}
+
+// openCache opens the result cache, creating it if needed
+func openCache() (*resultCache, error) {
+	dir, err := getCacheDir()
+	if err != nil {
+		return nil, err
+	}
+
+	maxSize := int64(defaultCacheMaxSize)
+	if config, err := loadConfig(); err == nil && config.CacheMaxSize > 0 {
+		maxSize = config.CacheMaxSize
+	}
+
+	return openCacheDir(dir, maxSize)
+}
+
+// openCacheDir opens the result cache kept in dir
+func openCacheDir(dir string, maxSize int64) (*resultCache, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "objects"), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	c := &resultCache{
+		dir:     dir,
+		maxSize: maxSize,
+		index:   make(map[string]*cacheEntry),
+		removed: make(map[string]bool),
+	}
+
+	entries, err := c.readIndex()
+	if errors.Is(err, errCacheIndexCorrupt) {
+		fmt.Fprintf(os.Stderr, "Warning: %v, clearing the cache\n", err)
+		if err := c.resetIndex(); err != nil {
+			return nil, err
+		}
+		entries, err = c.readIndex()
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		c.index[e.Key] = e
+	}
+
+	return c, nil
+}
+
+// openCacheForServer opens the cache and fetches the server version used in
+// cache keys. It returns a nil cache, after printing a warning, if the cache
+// is disabled or cannot be used.
+func openCacheForServer(ctx context.Context, client *bsubio.BsubClient, noCache bool) (*resultCache, string) {
+	if noCache {
+		return nil, ""
+	}
+
+	c, err := openCache()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: result cache disabled: %v\n", err)
+		return nil, ""
+	}
+
+	version, err := serverVersion(ctx, client)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: result cache disabled: %v\n", err)
+		return nil, ""
+	}
+
+	return c, version
+}
+
+func (c *resultCache) indexPath() string {
+	return filepath.Join(c.dir, "index.json")
+}
+
+func (c *resultCache) objectPath(key string) string {
+	return filepath.Join(c.dir, "objects", key)
+}
+
+// cacheKey derives the cache key for an input processed by a job type on a
+// given server version
+func cacheKey(inputSHA256, jobType, serverVersion string) string {
+	h := sha256.New()
+	h.Write([]byte(inputSHA256 + "\x00" + jobType + "\x00" + serverVersion))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// lookup returns the path of a cached output and marks it as recently used
+func (c *resultCache) lookup(key string) (*cacheEntry, string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.index[key]
+	if !ok {
+		return nil, "", false
+	}
+
+	path := c.objectPath(key)
+	if !fileExists(path) {
+		delete(c.index, key)
+		c.removed[key] = true
+		_ = c.saveLocked()
+		return nil, "", false
+	}
+
+	entry.LastUsed = time.Now().UTC()
+	_ = c.saveLocked()
+
+	return entry, path, true
+}
+
+// lookupJob finds a cached output by the job that produced it
+func (c *resultCache) lookupJob(jobID string) (*cacheEntry, string, bool) {
+	c.mu.Lock()
+	var key string
+	for k, e := range c.index {
+		if e.JobID == jobID {
+			key = k
+			break
+		}
+	}
+	c.mu.Unlock()
+
+	if key == "" {
+		return nil, "", false
+	}
+
+	return c.lookup(key)
+}
+
+// store moves a downloaded job output into the cache, first evicting old
+// entries to make room for it under the size limit. It returns the path of
+// the cached output. The file is left in place if it cannot be cached.
+func (c *resultCache) store(entry cacheEntry, file string) (string, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to write cache file: %w", err)
+	}
+	if info.Size() > c.maxSize {
+		return "", fmt.Errorf("output is larger than the cache size limit")
+	}
+
+	now := time.Now().UTC()
+	entry.Size = info.Size()
+	entry.CreatedAt = now
+	entry.LastUsed = now
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, _, err := c.evictLocked(c.maxSize-entry.Size, 0); err != nil {
+		return "", err
+	}
+
+	path := c.objectPath(entry.Key)
+	if err := os.Rename(file, path); err != nil {
+		return "", fmt.Errorf("failed to write cache file: %w", err)
+	}
+
+	// The index on disk is left unchanged when saving fails, so the output
+	// is moved back for the caller to use
+	c.index[entry.Key] = &entry
+	if err := c.saveLocked(); err != nil {
+		delete(c.index, entry.Key)
+		if renameErr := os.Rename(path, file); renameErr != nil {
+			return "", fmt.Errorf("%w (and failed to restore %s: %v)", err, file, renameErr)
+		}
+		return "", err
+	}
+
+	return path, nil
+}
+
+// storeJobOutput downloads the output of a finished job into the cache.
+// The download goes through downloadJobOutput, so it is resumed when
+// interrupted and its size and digest are checked: only complete outputs
+// are cached. If the output was downloaded but cannot be cached, e.g.
+// because it is larger than the cache, cached is false and path is the
+// downloaded file, which the caller removes once done with it.
+func (c *resultCache) storeJobOutput(ctx context.Context, client *bsubio.BsubClient, jobID bsubio.JobId, entry cacheEntry, progress bool) (path string, cached bool, err error) {
+	entry.JobID = jobID.String()
+
+	// Downloaded next to the cached outputs, so caching it is a rename
+	file := c.objectPath(entry.Key) + ".download"
+	if err := downloadJobOutput(ctx, client, jobID, file, progress); err != nil {
+		return "", false, err
+	}
+
+	path, err = c.store(entry, file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to cache output: %v\n", err)
+		return file, false, nil
+	}
+
+	return path, true, nil
+}
+
+// evict removes least recently used entries until the cache fits in
+// maxSize bytes, and entries not used for longer than maxAge (if non-zero).
+func (c *resultCache) evict(maxSize int64, maxAge time.Duration) (int, int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.evictLocked(maxSize, maxAge)
+}
+
+func (c *resultCache) evictLocked(maxSize int64, maxAge time.Duration) (removed int, freed int64, err error) {
+	// Entries stored by other processes count towards the size too
+	err = c.updateLocked(func() error {
+		entries := c.sortedLocked()
+
+		var total int64
+		for _, e := range entries {
+			total += e.Size
+		}
+
+		now := time.Now()
+
+		// Walk from the least recently used entry
+		for i := len(entries) - 1; i >= 0; i-- {
+			e := entries[i]
+			expired := maxAge > 0 && now.Sub(e.LastUsed) > maxAge
+			if total <= maxSize && !expired {
+				continue
+			}
+
+			if err := os.Remove(c.objectPath(e.Key)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove cache entry: %w", err)
+			}
+			delete(c.index, e.Key)
+			c.removed[e.Key] = true
+			total -= e.Size
+			freed += e.Size
+			removed++
+		}
+
+		return nil
+	})
+
+	return removed, freed, err
+}
+
+// entries returns all cache entries, most recently used first
+func (c *resultCache) entries() []*cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.sortedLocked()
+}
+
+func (c *resultCache) sortedLocked() []*cacheEntry {
+	entries := make([]*cacheEntry, 0, len(c.index))
+	for _, e := range c.index {
+		entries = append(entries, e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.After(entries[j].LastUsed)
+	})
+
+	return entries
+}
+
+// readIndex reads the index from disk
+func (c *resultCache) readIndex() ([]*cacheEntry, error) {
+	data, err := os.ReadFile(c.indexPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache index: %w", err)
+	}
+
+	var entries []*cacheEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("%w: %v", errCacheIndexCorrupt, err)
+	}
+	return entries, nil
+}
+
+// saveLocked writes the index atomically; the caller must hold c.mu
+func (c *resultCache) saveLocked() error {
+	return c.updateLocked(nil)
+}
+
+// updateLocked applies update to the index, if not nil, and writes it
+// atomically; the caller must hold c.mu. Other bsubio processes may have
+// changed the index since it was read, so it is updated under a lock file
+// and merged with the copy on disk first: entries removed by this process
+// stay removed, entries whose output is gone are dropped, and of two
+// copies of an entry the most recently used wins.
+func (c *resultCache) updateLocked(update func() error) error {
+	unlock, err := c.lockIndex()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	onDisk, err := c.readIndex()
+	if err != nil {
+		return err
+	}
+
+	disk := make(map[string]*cacheEntry, len(onDisk))
+	for _, e := range onDisk {
+		disk[e.Key] = e
+	}
+	for key := range c.index {
+		if _, ok := disk[key]; !ok && !fileExists(c.objectPath(key)) {
+			delete(c.index, key)
+		}
+	}
+	for key, e := range disk {
+		if c.removed[key] {
+			continue
+		}
+		if mine, ok := c.index[key]; !ok || e.LastUsed.After(mine.LastUsed) {
+			c.index[key] = e
+		}
+	}
+
+	// What was updated before a failure is saved all the same
+	var updateErr error
+	if update != nil {
+		updateErr = update()
+	}
+
+	data, err := json.MarshalIndent(c.sortedLocked(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache index: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(c.dir, "index.json.*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write cache index: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.indexPath())
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache index: %w", err)
+	}
+
+	clear(c.removed)
+	return updateErr
+}
+
+// resetIndex replaces a corrupt index with an empty one. The outputs it
+// described cannot be looked up anymore, so they are removed, leaving the
+// downloads in progress alone.
+func (c *resultCache) resetIndex() error {
+	unlock, err := c.lockIndex()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// Another process may have reset it in the meantime
+	if _, err := c.readIndex(); !errors.Is(err, errCacheIndexCorrupt) {
+		return err
+	}
+
+	files, err := os.ReadDir(filepath.Join(c.dir, "objects"))
+	if err != nil {
+		return fmt.Errorf("failed to clear cache: %w", err)
+	}
+	for _, f := range files {
+		if strings.Contains(f.Name(), ".") {
+			continue
+		}
+		if err := os.Remove(c.objectPath(f.Name())); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to clear cache: %w", err)
+		}
+	}
+
+	if err := os.WriteFile(c.indexPath(), []byte("[]\n"), 0600); err != nil {
+		return fmt.Errorf("failed to write cache index: %w", err)
+	}
+
+	return nil
+}
+
+// lockIndex creates the lock file serializing index updates between
+// processes, waiting for another process holding it, and returns the
+// function releasing it
+func (c *resultCache) lockIndex() (func(), error) {
+	path := filepath.Join(c.dir, "index.lock")
+	deadline := time.Now().Add(cacheLockTimeout)
+
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			_ = f.Close()
+			return func() {
+				_ = os.Remove(path)
+			}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to lock cache index: %w", err)
+		}
+
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > cacheLockStale {
+			_ = os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("failed to lock cache index: %s is held by another process", path)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// serverVersion returns the version reported by the API server, used as
+// part of the cache key so that server upgrades invalidate cached outputs
+func serverVersion(ctx context.Context, client *bsubio.BsubClient) (string, error) {
+	resp, err := client.GetVersionWithResponse(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get API version: %w", err)
+	}
+
+	if resp.StatusCode() != 200 {
+		return "", httpErrorf(resp.StatusCode(), "failed to get API version")
+	}
+
+	if resp.JSON200 == nil || resp.JSON200.Version == nil {
+		return "", fmt.Errorf("server did not report a version")
+	}
+
+	return *resp.JSON200.Version, nil
+}
+
+// entryForFile builds the cache entry describing an input file processed by
+// a job type on the given server version
+func entryForFile(path, jobType, version string) (cacheEntry, error) {
+	inputHash, err := hashFile(path)
+	if err != nil {
+		return cacheEntry{}, err
+	}
+
+	return cacheEntry{
+		Key:           cacheKey(inputHash, jobType, version),
+		Type:          jobType,
+		InputSHA256:   inputHash,
+		ServerVersion: version,
+	}, nil
+}
+
+// copyFileTo writes the contents of a file to w
+func copyFileTo(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	_, err = io.Copy(w, file)
+	return err
+}
+
+func runCache(args []string) error {
+	if len(args) == 0 {
+		return usageErrorf("usage: bsubio cache ls|prune|clear")
+	}
+
+	switch args[0] {
+	case "ls":
+		return runCacheLs(args[1:])
+	case "prune":
+		return runCachePrune(args[1:])
+	case "clear":
+		return runCacheClear(args[1:])
+	default:
+		return usageErrorf("unknown cache command: %s\nRun 'bsubio help cache' for usage", args[0])
+	}
+}
+
+var cacheColumns = []outputColumn[*cacheEntry]{
+	{"key", func(e *cacheEntry) string { return e.Key }},
+	{"job_id", func(e *cacheEntry) string { return e.JobID }},
+	{"type", func(e *cacheEntry) string { return e.Type }},
+	{"input_sha256", func(e *cacheEntry) string { return e.InputSHA256 }},
+	{"server_version", func(e *cacheEntry) string { return e.ServerVersion }},
+	{"size", func(e *cacheEntry) string { return fmt.Sprint(e.Size) }},
+	{"created_at", func(e *cacheEntry) string { return csvTime(&e.CreatedAt) }},
+	{"last_used", func(e *cacheEntry) string { return csvTime(&e.LastUsed) }},
+}
+
+func runCacheLs(args []string) error {
+	fs := flag.NewFlagSet("cache ls", flag.ContinueOnError)
+
+	out := addOutputFlags(fs)
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bsubio cache ls [options]\n\n")
+		fmt.Fprintf(fs.Output(), "List cache entries, most recently used first\n\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return usageErrorf("expected 0 arguments, got %d", fs.NArg())
+	}
+
+	if err := out.check(); err != nil {
+		return err
+	}
+
+	c, err := openCache()
+	if err != nil {
+		return err
+	}
+
+	entries := c.entries()
+	if !out.table() {
+		return printList(out, entries, cacheColumns)
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("Cache is empty")
+		return nil
+	}
+
+	fmt.Printf("%-12s %-36s %-20s %10s %s\n", "KEY", "JOB ID", "TYPE", "SIZE", "LAST USED")
+	fmt.Println("--------------------------------------------------------------------------------")
+
+	var total int64
+	for _, e := range entries {
+		fmt.Printf("%-12s %-36s %-20s %10s %s\n",
+			e.Key[:12],
+			e.JobID,
+			truncate(e.Type, 20),
+			formatBytes(e.Size),
+			e.LastUsed.Local().Format("2006-01-02 15:04"))
+		total += e.Size
+	}
+
+	fmt.Println("--------------------------------------------------------------------------------")
+	fmt.Printf("%d entries, %s of %s (%s)\n", len(entries), formatBytes(total), formatBytes(c.maxSize), c.dir)
+
+	return nil
+}
+
+func runCachePrune(args []string) error {
+	fs := flag.NewFlagSet("cache prune", flag.ContinueOnError)
+
+	maxSize := fs.String("max-size", "", "Shrink the cache to this size (e.g., 500MB; default: configured limit)")
+	maxAge := fs.Duration("max-age", 0, "Remove entries not used for this long (e.g., 720h)")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bsubio cache prune [options]\n\n")
+		fmt.Fprintf(fs.Output(), "Remove least recently used cache entries\n\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return usageErrorf("expected 0 arguments, got %d", fs.NArg())
+	}
+
+	c, err := openCache()
+	if err != nil {
+		return err
+	}
+
+	limit := c.maxSize
+	if *maxSize != "" {
+		limit, err = parseSize(*maxSize)
+		if err != nil {
+			return err
+		}
+	}
+
+	removed, freed, err := c.evict(limit, *maxAge)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Removed %d entries, freed %s\n", removed, formatBytes(freed))
+	return nil
+}
+
+func runCacheClear(args []string) error {
+	fs := flag.NewFlagSet("cache clear", flag.ContinueOnError)
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bsubio cache clear\n\n")
+		fmt.Fprintf(fs.Output(), "Remove all cache entries\n")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return usageErrorf("expected 0 arguments, got %d", fs.NArg())
+	}
+
+	c, err := openCache()
+	if err != nil {
+		return err
+	}
+
+	removed, freed, err := c.evict(-1, 0)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Removed %d entries, freed %s\n", removed, formatBytes(freed))
+	return nil
+}
+
+// parseSize parses sizes like "512", "200KB", "1.5GB" or "1GiB" into bytes
+func parseSize(s string) (int64, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+	str = strings.TrimSuffix(strings.TrimSuffix(str, "IB"), "B")
+
+	multiplier := int64(1)
+	if n := len(str); n > 0 {
+		switch str[n-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		case 'T':
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			str = str[:n-1]
+		}
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+	if err != nil || value < 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+
+	return int64(value * float64(multiplier)), nil
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCacheIndexConcurrentStores(t *testing.T) {
+	dir := t.TempDir()
+
+	// Separate caches on the same directory stand for separate processes
+	const processes = 8
+	caches := make([]*resultCache, processes)
+	for i := range caches {
+		c, err := openCacheDir(dir, 1<<20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		caches[i] = c
+	}
+
+	var wg sync.WaitGroup
+	for i, c := range caches {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key := string(rune('a' + i))
+			file := filepath.Join(t.TempDir(), "output")
+			if err := os.WriteFile(file, []byte(key), 0644); err != nil {
+				t.Error(err)
+				return
+			}
+			if _, err := c.store(cacheEntry{Key: key}, file); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	c, err := openCacheDir(dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, e := range c.entries() {
+		keys = append(keys, e.Key)
+	}
+	sort.Strings(keys)
+	if want := []string{"a", "b", "c", "d", "e", "f", "g", "h"}; !slices.Equal(keys, want) {
+		t.Fatalf("index holds %v, want %v", keys, want)
+	}
+
+	// An entry removed by one process is not brought back by another one
+	// saving the copy of the index it read earlier
+	if _, _, err := caches[0].evict(-1, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := caches[1].lookup("b"); ok {
+		t.Errorf("lookup found an entry removed by another process")
+	}
+	c, err = openCacheDir(dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := c.entries(); len(entries) != 0 {
+		t.Errorf("index holds %d entries after clear, want 0", len(entries))
+	}
+}
+
+// seedCache writes cache entries of 10 bytes each into dir, the first one
+// used most recently
+func seedCache(t *testing.T, dir string, keys ...string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Join(dir, "objects"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	var entries []*cacheEntry
+	for i, key := range keys {
+		if err := os.WriteFile(filepath.Join(dir, "objects", key), []byte("0123456789"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		used := now.Add(-time.Duration(i+1) * time.Hour)
+		entries = append(entries, &cacheEntry{Key: key, Size: 10, CreatedAt: used, LastUsed: used})
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "index.json"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// cacheKeys returns the keys in the cache, most recently used first
+func cacheKeys(c *resultCache) []string {
+	var keys []string
+	for _, e := range c.entries() {
+		keys = append(keys, e.Key)
+	}
+	return keys
+}
+
+// writeCacheOutput writes a downloaded output of size bytes
+func writeCacheOutput(t *testing.T, size int) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "output")
+	if err := os.WriteFile(file, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	dir := t.TempDir()
+	seedCache(t, dir, "a", "c", "b")
+
+	c, err := openCacheDir(dir, 35)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Storing d makes room for it by evicting b, the least recently used
+	path, err := c.store(cacheEntry{Key: "d"}, writeCacheOutput(t, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fileExists(path) {
+		t.Errorf("cached output %s is missing", path)
+	}
+	if got, want := cacheKeys(c), []string{"d", "a", "c"}; !slices.Equal(got, want) {
+		t.Errorf("cache holds %v, want %v", got, want)
+	}
+	if fileExists(filepath.Join(dir, "objects", "b")) {
+		t.Errorf("output of evicted entry b was not removed")
+	}
+
+	// Using c makes a the least recently used one
+	if _, _, ok := c.lookup("c"); !ok {
+		t.Fatal("lookup(c) found nothing")
+	}
+	removed, freed, err := c.evict(20, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 || freed != 10 {
+		t.Errorf("evict() removed %d entries of %d bytes, want 1 of 10", removed, freed)
+	}
+	if got, want := cacheKeys(c), []string{"c", "d"}; !slices.Equal(got, want) {
+		t.Errorf("cache holds %v, want %v", got, want)
+	}
+}
+
+func TestCacheStoreLeavesFileWhenNotCached(t *testing.T) {
+	t.Run("larger than the cache", func(t *testing.T) {
+		dir := t.TempDir()
+		seedCache(t, dir, "a")
+
+		c, err := openCacheDir(dir, 35)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		file := writeCacheOutput(t, 36)
+		if _, err := c.store(cacheEntry{Key: "big"}, file); err == nil {
+			t.Fatal("store() of an output over the limit succeeded")
+		}
+		if !fileExists(file) {
+			t.Errorf("output was not left in place")
+		}
+		if got, want := cacheKeys(c), []string{"a"}; !slices.Equal(got, want) {
+			t.Errorf("cache holds %v, want %v", got, want)
+		}
+	})
+
+	t.Run("index cannot be updated", func(t *testing.T) {
+		dir := t.TempDir()
+		seedCache(t, dir, "a")
+
+		c, err := openCacheDir(dir, 35)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// A directory in place of the index makes every update fail
+		index := filepath.Join(dir, "index.json")
+		if err := os.Remove(index); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Mkdir(index, 0700); err != nil {
+			t.Fatal(err)
+		}
+
+		file := writeCacheOutput(t, 10)
+		if _, err := c.store(cacheEntry{Key: "b"}, file); err == nil {
+			t.Fatal("store() succeeded without an index")
+		}
+		if !fileExists(file) {
+			t.Errorf("output was not left in place")
+		}
+		if fileExists(filepath.Join(dir, "objects", "b")) {
+			t.Errorf("output was moved into the cache")
+		}
+		if _, _, ok := c.lookup("b"); ok {
+			t.Errorf("lookup found an entry that was not stored")
+		}
+	})
+}
+
+func TestCacheTakesOverStaleLock(t *testing.T) {
+	dir := t.TempDir()
+	seedCache(t, dir, "a")
+
+	c, err := openCacheDir(dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Left over by a process that crashed while holding it
+	lock := filepath.Join(dir, "index.lock")
+	if err := os.WriteFile(lock, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * cacheLockStale)
+	if err := os.Chtimes(lock, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	file := writeCacheOutput(t, 10)
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.store(cacheEntry{Key: "b"}, file)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(cacheLockTimeout / 2):
+		t.Fatal("store() waited for a stale lock")
+	}
+
+	if fileExists(lock) {
+		t.Errorf("lock file was not released")
+	}
+	if got, want := cacheKeys(c), []string{"b", "a"}; !slices.Equal(got, want) {
+		t.Errorf("cache holds %v, want %v", got, want)
+	}
+}
+
+func TestCacheRecoversCorruptIndex(t *testing.T) {
+	dir := t.TempDir()
+	seedCache(t, dir, "a", "b")
+
+	// A download in progress is not part of the index yet
+	download := filepath.Join(dir, "objects", "c.download")
+	if err := os.WriteFile(download, []byte("partial"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "index.json"), []byte(`[{"key": "a"`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := openCacheDir(dir, 1<<20)
+	if err != nil {
+		t.Fatalf("openCacheDir() with a corrupt index failed: %v", err)
+	}
+	if keys := cacheKeys(c); len(keys) != 0 {
+		t.Errorf("cache holds %v after recovering, want nothing", keys)
+	}
+	for _, key := range []string{"a", "b"} {
+		if fileExists(filepath.Join(dir, "objects", key)) {
+			t.Errorf("output of lost entry %s was not removed", key)
+		}
+	}
+	if !fileExists(download) {
+		t.Errorf("download in progress was removed")
+	}
+
+	if _, err := c.store(cacheEntry{Key: "c"}, writeCacheOutput(t, 10)); err != nil {
+		t.Fatal(err)
+	}
+	c, err = openCacheDir(dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cacheKeys(c), []string{"c"}; !slices.Equal(got, want) {
+		t.Errorf("cache holds %v, want %v", got, want)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"512", 512, false},
+		{"512B", 512, false},
+		{"200KB", 200 << 10, false},
+		{"200kb", 200 << 10, false},
+		{"1.5GB", 3 << 29, false},
+		{"1GiB", 1 << 30, false},
+		{"2M", 2 << 20, false},
+		{"1TB", 1 << 40, false},
+		{" 10 MB ", 10 << 20, false},
+		{"0", 0, false},
+		{"", 0, true},
+		{"GB", 0, true},
+		{"-1MB", 0, true},
+		{"ten", 0, true},
+		{"NaN", 0, true},
+		{"InfGB", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseSize(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSize(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
@@ -1,110 +1,92 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/bsubio/bsubio-go"
-	"github.com/google/uuid"
 )
 
+// cancelAction cancels jobs that are still pending or running
+var cancelAction = &bulkAction{
+	Verb: "cancel",
+	Done: "Canceled",
+	Applies: func(job *bsubio.Job) bool {
+		return !jobDone(job)
+	},
+	Run: cancelJob,
+}
+
 func runCancel(args []string) error {
 	fs := flag.NewFlagSet("cancel", flag.ContinueOnError)
 
 	// Define flags
-	cancelAll := fs.Bool("a", false, "Cancel all pending/claimed jobs")
+	opts := addBulkFlags(fs, cancelAction)
 
 	// Custom usage function
 	fs.Usage = func() {
-		fmt.Fprintf(fs.Output(), "Usage: bsubio cancel [options] [jobid]\n\n")
-		fmt.Fprintf(fs.Output(), "Cancel a job or all jobs\n\n")
+		fmt.Fprintf(fs.Output(), "Usage: bsubio cancel [options] [<jobid>...]\n\n")
+		fmt.Fprintf(fs.Output(), "Cancel jobs given by ID, or all pending and running jobs matching filters\n\n")
 		fmt.Fprintf(fs.Output(), "Options:\n")
 		fs.PrintDefaults()
 		fmt.Fprintf(fs.Output(), "\nArguments:\n")
-		fmt.Fprintf(fs.Output(), "  jobid    Job ID to cancel (not required with -a)\n")
+		fmt.Fprintf(fs.Output(), "  jobid    Job IDs, ID prefixes, job names or @last[~N], or - to read them\n")
+		fmt.Fprintf(fs.Output(), "           from stdin (not used with -a or filters)\n")
 	}
 
 	// Parse flags
 	if err := fs.Parse(args); err != nil {
-		return err
+		return usageError(err)
 	}
 
-	// Get remaining arguments
-	remainingArgs := fs.Args()
-	var jobID string
-
-	// If not canceling all, require job ID
-	if !*cancelAll {
-		if len(remainingArgs) != 1 {
-			fs.Usage()
-			return fmt.Errorf("expected 1 argument when not using -a flag")
-		}
-		jobID = remainingArgs[0]
-	}
+	return runBulk(fs, opts, cancelAction)
+}
 
-	// Create client
-	client, err := createClient()
+// cancelJob cancels a single job
+func cancelJob(ctx context.Context, client *bsubio.BsubClient, jobID bsubio.JobId) error {
+	resp, err := client.CancelJobWithResponse(ctx, jobID)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to cancel job: %w", err)
 	}
 
-	ctx := getContext()
-
-	if *cancelAll {
-		// List all jobs and cancel pending/claimed ones
-		resp, err := client.ListJobsWithResponse(ctx, &bsubio.ListJobsParams{})
-		if err != nil {
-			return fmt.Errorf("failed to list jobs: %w", err)
-		}
-
-		if resp.StatusCode() != 200 {
-			return fmt.Errorf("failed to list jobs: HTTP %d", resp.StatusCode())
-		}
-
-		if resp.JSON200 == nil || resp.JSON200.Data == nil || resp.JSON200.Data.Jobs == nil {
-			return fmt.Errorf("unexpected response format")
-		}
-
-		jobs := *resp.JSON200.Data.Jobs
-		canceledCount := 0
+	if resp.StatusCode() != 200 {
+		return httpErrorf(resp.StatusCode(), "failed to cancel job")
+	}
 
-		for _, job := range jobs {
-			if job.Status != nil && (*job.Status == "pending" || *job.Status == "claimed") {
-				cancelResp, err := client.CancelJobWithResponse(ctx, *job.Id)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Failed to cancel job %s: %v\n", *job.Id, err)
-					continue
-				}
+	return nil
+}
 
-				if cancelResp.StatusCode() != 200 {
-					fmt.Fprintf(os.Stderr, "Failed to cancel job %s: HTTP %d\n", *job.Id, cancelResp.StatusCode())
-					continue
-				}
+// handleInterruptedWait deals with jobs still running when waiting for them
+// was interrupted by Ctrl-C or SIGTERM, or ran out of time. Interrupted jobs
+// are canceled if cancel is set; otherwise the user is told how to cancel
+// them.
+func handleInterruptedWait(client *bsubio.BsubClient, cancel bool, jobIDs ...bsubio.JobId) {
+	cause := context.Cause(getContext())
+	interrupted := errors.Is(cause, errInterrupted)
+	if !interrupted && !errors.Is(cause, errTimedOut) {
+		return
+	}
 
-				fmt.Fprintf(os.Stderr, "Canceled job: %s\n", *job.Id)
-				canceledCount++
-			}
+	if !cancel || !interrupted {
+		for _, jobID := range jobIDs {
+			fmt.Fprintf(os.Stderr, "Job %s is still running, cancel it with 'bsubio cancel %s'\n", jobID, jobID)
 		}
+		return
+	}
 
-		fmt.Fprintf(os.Stderr, "Canceled %d job(s)\n", canceledCount)
-	} else {
-		// Cancel single job
-		jobUUID, err := uuid.Parse(jobID)
-		if err != nil {
-			return fmt.Errorf("invalid job ID: %w", err)
-		}
-		resp, err := client.CancelJobWithResponse(ctx, jobUUID)
-		if err != nil {
-			return fmt.Errorf("failed to cancel job: %w", err)
-		}
+	// The command context is already canceled, so use a fresh one
+	ctx, stop := context.WithTimeout(context.Background(), 10*time.Second)
+	defer stop()
 
-		if resp.StatusCode() != 200 {
-			return fmt.Errorf("failed to cancel job: HTTP %d", resp.StatusCode())
+	for _, jobID := range jobIDs {
+		if err := cancelJob(ctx, client, jobID); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to cancel job %s: %v\n", jobID, err)
+			continue
 		}
-
-		fmt.Fprintf(os.Stderr, "Job canceled: %s\n", jobID)
+		fmt.Fprintf(os.Stderr, "Canceled job: %s\n", jobID)
 	}
-
-	return nil
 }
@@ -4,43 +4,39 @@ import (
 	"flag"
 	"fmt"
 	"os"
-
-	"github.com/google/uuid"
 )
 
 func runCat(args []string) error {
 	fs := flag.NewFlagSet("cat", flag.ContinueOnError)
 	wait := fs.Bool("wait", false, "Wait for job to complete before showing output")
+	outputFile := fs.String("o", "", "Save the output to this file instead of printing it")
+	noCache := fs.Bool("no-cache", false, "Do not use the local result cache")
+	cancelOnInterrupt := fs.Bool("cancel-on-interrupt", false, "Cancel the job if waiting is interrupted with Ctrl-C (with -wait)")
 
 	// Custom usage function
 	fs.Usage = func() {
 		fmt.Fprintf(fs.Output(), "Usage: bsubio cat [options] <jobid>\n\n")
 		fmt.Fprintf(fs.Output(), "Print job output (stdout)\n\n")
 		fmt.Fprintf(fs.Output(), "Arguments:\n")
-		fmt.Fprintf(fs.Output(), "  jobid    Job ID\n\n")
+		fmt.Fprintf(fs.Output(), "  jobid    Job ID, ID prefix, job name or @last[~N]\n\n")
 		fmt.Fprintf(fs.Output(), "Options:\n")
 		fs.PrintDefaults()
 	}
 
 	// Parse flags
 	if err := fs.Parse(args); err != nil {
-		return err
+		return usageError(err)
 	}
 
 	// Get remaining arguments
 	remainingArgs := fs.Args()
 	if len(remainingArgs) != 1 {
 		fs.Usage()
-		return fmt.Errorf("expected 1 argument, got %d", len(remainingArgs))
+		return usageErrorf("expected 1 argument, got %d", len(remainingArgs))
 	}
 
 	jobID := remainingArgs[0]
 
-	jobUUID, err := uuid.Parse(jobID)
-	if err != nil {
-		return fmt.Errorf("invalid job ID: %w", err)
-	}
-
 	// Create client
 	client, err := createClient()
 	if err != nil {
@@ -49,6 +45,20 @@ func runCat(args []string) error {
 
 	ctx := getContext()
 
+	jobUUID, err := resolveJobID(ctx, client, jobID)
+	if err != nil {
+		return err
+	}
+
+	// Outputs kept in the result cache don't need a round trip to the server
+	if !*noCache {
+		if cache, err := openCache(); err == nil {
+			if _, path, ok := cache.lookupJob(jobUUID.String()); ok {
+				return writeCachedOutput(path, *outputFile)
+			}
+		}
+	}
+
 	// Check job status first
 	statusResp, err := client.GetJobWithResponse(ctx, jobUUID)
 	if err != nil {
@@ -56,7 +66,7 @@ func runCat(args []string) error {
 	}
 
 	if statusResp.StatusCode() != 200 {
-		return fmt.Errorf("failed to get job status: HTTP %d", statusResp.StatusCode())
+		return httpErrorf(statusResp.StatusCode(), "failed to get job status")
 	}
 
 	if statusResp.JSON200 == nil || statusResp.JSON200.Data == nil {
@@ -72,39 +82,24 @@ func runCat(args []string) error {
 	if *job.Status != "finished" && *job.Status != "failed" {
 		if *wait {
 			fmt.Fprintf(os.Stderr, "Job is %s, waiting for completion...\n", *job.Status)
-			finishedJob, err := client.WaitForJob(ctx, jobUUID)
+			finishedJob, err := waitForJob(ctx, client, jobUUID)
 			if err != nil {
+				handleInterruptedWait(client, *cancelOnInterrupt, jobUUID)
 				return fmt.Errorf("failed to wait for job: %w", err)
 			}
+			recordJobStatus(finishedJob)
 
 			if finishedJob.Status != nil && *finishedJob.Status == "failed" {
-				if finishedJob.ErrorMessage != nil {
-					return fmt.Errorf("job failed: %s", *finishedJob.ErrorMessage)
-				}
-				return fmt.Errorf("job failed")
+				return jobFailedError(jobUUID, finishedJob.ErrorMessage)
 			}
 		} else {
-			return fmt.Errorf("job is not complete (status: %s). Use 'bsubio wait %s' first or use -wait flag", *job.Status, jobID)
+			return &cliError{
+				Kind:  kindJobRunning,
+				JobID: jobUUID.String(),
+				Err:   fmt.Errorf("job is not complete (status: %s). Use 'bsubio wait %s' first or use -wait flag", *job.Status, jobID),
+			}
 		}
 	}
 
-	// Get job output
-	resp, err := client.GetJobOutput(ctx, jobUUID)
-	if err != nil {
-		return fmt.Errorf("failed to get job output: %w", err)
-	}
-	defer func() {
-		_ = resp.Body.Close()
-	}()
-
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("failed to get job output: HTTP %d", resp.StatusCode)
-	}
-
-	// Write output to stdout
-	if _, err := os.Stdout.ReadFrom(resp.Body); err != nil {
-		return fmt.Errorf("failed to write output: %w", err)
-	}
-
-	return nil
+	return writeOutput(ctx, client, jobUUID, *outputFile)
 }
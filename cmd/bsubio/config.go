@@ -16,6 +16,17 @@ import (
 type Config struct {
 	APIKey  string `json:"api_key"`
 	BaseURL string `json:"base_url"`
+
+	// CacheMaxSize limits the size of the local result cache in bytes
+	// (0 means the default limit)
+	CacheMaxSize int64 `json:"cache_max_size,omitempty"`
+
+	// TypesCacheTTL is how long the job types are cached, e.g. "1h" ("0"
+	// disables the cache, empty means the default)
+	TypesCacheTTL string `json:"types_cache_ttl,omitempty"`
+
+	// GC holds the retention rules of bsubio gc
+	GC *GCConfig `json:"gc,omitempty"`
 }
 
 // getConfigPath returns the path to the config file
@@ -39,7 +50,7 @@ func loadConfig() (*Config, error) {
 	data, err := os.ReadFile(configPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("bsubio not setup. To setup, run:\n\nbsubio config")
+			return nil, errorf(kindAuth, "bsubio not setup. To setup, run:\n\nbsubio config")
 		}
 		return nil, fmt.Errorf("failed to read config: %w", err)
 	}
@@ -106,11 +117,14 @@ func runConfig(args []string) error {
 		baseURL = "https://app.bsub.io"
 	}
 
-	// Save configuration
-	config := &Config{
-		APIKey:  apiKey,
-		BaseURL: baseURL,
+	// Save configuration, keeping any other settings already in the file
+	config, err := loadConfig()
+	if err != nil {
+		// Start from scratch if there is no usable config yet
+		config = &Config{}
 	}
+	config.APIKey = apiKey
+	config.BaseURL = baseURL
 
 	if err := saveConfig(config); err != nil {
 		return err
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bsubio/bsubio-go"
+)
+
+// Job outputs saved to files are downloaded into "<file>.part" and renamed
+// to their final name only once complete, so a failed download never
+// leaves a truncated file that looks valid. Next to the partial file,
+// "<file>.part.json" records the job and the ETag of the output, so that an
+// interrupted download is resumed with an HTTP Range request, by the same
+// command after a dropped connection or by running it again later. The
+// If-Range header makes the server send the whole output again if it has
+// changed in the meantime.
+//
+// Once downloaded, the file's size is checked against Content-Length or
+// Content-Range, and its checksum against the Repr-Digest or Digest
+// header, when the server sends them.
+
+// downloadMaxRetries is how many times an interrupted download is resumed
+// before giving up (it can still be resumed by running the command again)
+const downloadMaxRetries = 5
+
+// downloadRetryDelay is the pause before the first retry; it doubles on
+// every further attempt
+var downloadRetryDelay = time.Second
+
+// downloadState describes an unfinished download
+type downloadState struct {
+	JobID string `json:"job_id"`
+	ETag  string `json:"etag,omitempty"`
+}
+
+// outputDownload is a download of a job output into a file
+type outputDownload struct {
+	client    *bsubio.BsubClient
+	jobID     bsubio.JobId
+	path      string
+	partPath  string
+	statePath string
+	state     *downloadState
+	bar       *progressBar
+}
+
+// downloadJobOutput downloads the output of a finished job into path,
+// resuming a previous interrupted download of the same job if there is one.
+// With progress, a progress bar is shown on terminals.
+func downloadJobOutput(ctx context.Context, client *bsubio.BsubClient, jobID bsubio.JobId, path string, progress bool) error {
+	d := &outputDownload{
+		client:    client,
+		jobID:     jobID,
+		path:      path,
+		partPath:  path + ".part",
+		statePath: path + ".part.json",
+		bar:       newProgressBar("Downloading", 0),
+	}
+	if !progress {
+		d.bar.enabled = false
+	}
+
+	// A partial file is only resumed if it belongs to the same job
+	d.state = loadDownloadState(d.statePath)
+	if d.state == nil || d.state.JobID != jobID.String() {
+		d.state = &downloadState{JobID: jobID.String()}
+		_ = os.Remove(d.partPath)
+	}
+
+	err := d.run(ctx)
+	d.bar.Finish()
+	if err != nil {
+		if info, statErr := os.Stat(d.partPath); statErr == nil && info.Size() > 0 {
+			return fmt.Errorf("%w (partial download kept in %s, run the command again to resume)", err, d.partPath)
+		}
+		_ = os.Remove(d.statePath)
+		return err
+	}
+
+	if err := os.Rename(d.partPath, path); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	_ = os.Remove(d.statePath)
+
+	return nil
+}
+
+// run downloads the output, resuming after network errors
+func (d *outputDownload) run(ctx context.Context) error {
+	delay := downloadRetryDelay
+
+	for attempt := 0; ; attempt++ {
+		retry, err := d.attempt(ctx)
+		if err == nil || !retry || attempt >= downloadMaxRetries || ctx.Err() != nil {
+			return err
+		}
+
+		wait := delay
+		var throttled *throttledError
+		if errors.As(err, &throttled) && throttled.RetryAfter > 0 {
+			wait = throttled.RetryAfter
+		}
+
+		fmt.Fprintf(os.Stderr, "Warning: %v, retrying in %s\n", err, wait)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		delay *= 2
+	}
+}
+
+// attempt downloads the output from where the partial file ends. It
+// returns whether a failure is worth retrying.
+func (d *outputDownload) attempt(ctx context.Context) (bool, error) {
+	var offset int64
+	if info, err := os.Stat(d.partPath); err == nil {
+		offset = info.Size()
+	}
+
+	etag := d.state.ETag
+	resp, err := d.client.GetJobOutput(ctx, d.jobID, func(ctx context.Context, req *http.Request) error {
+		if offset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+			if etag != "" {
+				req.Header.Set("If-Range", etag)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return true, fmt.Errorf("failed to get job output: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if err := checkThrottled(resp); err != nil {
+		return true, err
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE
+	total := int64(-1)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		offset = 0
+		flags |= os.O_TRUNC
+		total = resp.ContentLength
+	case http.StatusPartialContent:
+		start, size, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			_ = os.Remove(d.partPath)
+			return true, fmt.Errorf("unexpected Content-Range %q, restarting download", resp.Header.Get("Content-Range"))
+		}
+		if newETag := resp.Header.Get("ETag"); etag != "" && newETag != "" && newETag != etag {
+			_ = os.Remove(d.partPath)
+			return true, fmt.Errorf("output changed since the download started, restarting download")
+		}
+		flags |= os.O_APPEND
+		total = size
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial file may hold the whole output already, otherwise the
+		// output must have changed
+		if size, ok := strings.CutPrefix(resp.Header.Get("Content-Range"), "bytes */"); ok && size == strconv.FormatInt(offset, 10) {
+			return false, nil
+		}
+		_ = os.Remove(d.partPath)
+		return true, fmt.Errorf("partial download does not match the output, restarting download")
+	default:
+		return false, httpErrorf(resp.StatusCode, "failed to get job output")
+	}
+
+	d.state.ETag = resp.Header.Get("ETag")
+	if err := saveDownloadState(d.statePath, d.state); err != nil {
+		return false, err
+	}
+
+	file, err := os.OpenFile(d.partPath, flags, 0644)
+	if err != nil {
+		return false, fmt.Errorf("failed to create output file: %w", err)
+	}
+
+	d.bar.SetTotal(total)
+	d.bar.Set(offset)
+
+	n, err := io.Copy(file, &progressReader{r: resp.Body, bar: d.bar})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return true, fmt.Errorf("download interrupted: %w", err)
+	}
+
+	if size := offset + n; total >= 0 && size != total {
+		return true, fmt.Errorf("download incomplete: got %d of %d bytes", size, total)
+	}
+
+	if err := verifyDigest(d.partPath, resp.Header); err != nil {
+		// Corrupt data cannot be resumed, start over
+		_ = os.Remove(d.partPath)
+		return true, err
+	}
+
+	return false, nil
+}
+
+// parseContentRange parses a "bytes <start>-<end>/<size>" Content-Range
+// header. The size is -1 if the header gives it as "*".
+func parseContentRange(header string) (int64, int64, bool) {
+	start, ok := parseContentRangeStart(header)
+	if !ok {
+		return 0, 0, false
+	}
+
+	_, sizeStr, ok := strings.Cut(header, "/")
+	if !ok {
+		return 0, 0, false
+	}
+	if sizeStr == "*" {
+		return start, -1, true
+	}
+
+	size, err := strconv.ParseInt(sizeStr, 10, 64)
+	if err != nil || size < start {
+		return 0, 0, false
+	}
+
+	return start, size, true
+}
+
+// verifyDigest checks a downloaded file against the SHA-256 or SHA-512
+// digest in a Repr-Digest (RFC 9530) or Digest (RFC 3230) header. Both
+// describe the whole output, even for partial responses. Files without a
+// supported digest are not checked.
+func verifyDigest(path string, header http.Header) error {
+	algorithm, want, ok := parseDigest(header)
+	if !ok {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to verify output: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	var h hash.Hash
+	switch algorithm {
+	case "sha-256":
+		h = sha256.New()
+	case "sha-512":
+		h = sha512.New()
+	}
+
+	if _, err := io.Copy(h, file); err != nil {
+		return fmt.Errorf("failed to verify output: %w", err)
+	}
+
+	if got := h.Sum(nil); string(got) != string(want) {
+		return fmt.Errorf("output checksum mismatch (%s)", algorithm)
+	}
+
+	return nil
+}
+
+// parseDigest returns the first supported digest from the Repr-Digest or
+// Digest header
+func parseDigest(header http.Header) (string, []byte, bool) {
+	for _, name := range []string{"Repr-Digest", "Digest"} {
+		for _, field := range strings.Split(header.Get(name), ",") {
+			algorithm, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+			if !ok {
+				continue
+			}
+
+			algorithm = strings.ToLower(algorithm)
+			if algorithm != "sha-256" && algorithm != "sha-512" {
+				continue
+			}
+
+			// Repr-Digest wraps the value in colons, Digest does not
+			sum, err := base64.StdEncoding.DecodeString(strings.Trim(value, ":"))
+			if err != nil {
+				continue
+			}
+
+			return algorithm, sum, true
+		}
+	}
+
+	return "", nil, false
+}
+
+func loadDownloadState(path string) *downloadState {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	var state downloadState
+	if err := json.Unmarshal(data, &state); err != nil {
+		// A corrupt state file only means the download starts over
+		return nil
+	}
+
+	return &state
+}
+
+func saveDownloadState(path string, state *downloadState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal download state: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write download state: %w", err)
+	}
+
+	return nil
+}
+
+// writeFileAtomic writes a file through write, into a temporary file in the
+// same directory that is renamed once complete
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	err = tmp.Chmod(0644)
+	if err == nil {
+		err = write(tmp)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	return nil
+}
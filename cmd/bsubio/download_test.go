@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bsubio/bsubio-go"
+	"github.com/google/uuid"
+)
+
+// fakeOutputServer serves a job output with Range and ETag support. The
+// first drops responses are cut off after half of the requested bytes.
+type fakeOutputServer struct {
+	mu     sync.Mutex
+	data   []byte
+	etag   string
+	digest string
+	drops  int
+	ranges []string
+}
+
+func (s *fakeOutputServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !strings.HasSuffix(r.URL.Path, "/output") {
+		http.NotFound(w, r)
+		return
+	}
+
+	rng := r.Header.Get("Range")
+	s.ranges = append(s.ranges, rng)
+
+	w.Header().Set("ETag", s.etag)
+	if s.digest != "" {
+		w.Header().Set("Repr-Digest", s.digest)
+	}
+
+	start := 0
+	if rng != "" && r.Header.Get("If-Range") == s.etag {
+		start, _ = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"))
+	}
+
+	body := s.data[start:]
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	if start > 0 {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(s.data)-1, len(s.data)))
+		w.WriteHeader(http.StatusPartialContent)
+	}
+
+	if s.drops > 0 {
+		s.drops--
+		_, _ = w.Write(body[:len(body)/2])
+		// Closing the connection early makes the client see a short body
+		if conn, _, err := w.(http.Hijacker).Hijack(); err == nil {
+			_ = conn.Close()
+		}
+		return
+	}
+
+	_, _ = w.Write(body)
+}
+
+func setupDownloadTest(t *testing.T, fake *fakeOutputServer) (*bsubio.BsubClient, string) {
+	t.Helper()
+
+	oldDelay := downloadRetryDelay
+	downloadRetryDelay = 0
+	t.Cleanup(func() { downloadRetryDelay = oldDelay })
+
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	client, err := bsubio.NewBsubClient(bsubio.Config{APIKey: "test", BaseURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client, filepath.Join(t.TempDir(), "out.txt")
+}
+
+func TestDownloadResumesDroppedConnection(t *testing.T) {
+	data := []byte(strings.Repeat("0123456789", 1000))
+	fake := &fakeOutputServer{data: data, etag: `"v1"`, drops: 2}
+	client, path := setupDownloadTest(t, fake)
+
+	if err := downloadJobOutput(context.Background(), client, uuid.New(), path, false); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(data) {
+		t.Errorf("downloaded %d bytes, want the %d bytes of the output", len(got), len(data))
+	}
+
+	// Every retry continues where the previous response was cut off
+	if want := []string{"", "bytes=5000-", "bytes=7500-"}; !slices.Equal(fake.ranges, want) {
+		t.Errorf("Range headers = %q, want %q", fake.ranges, want)
+	}
+
+	for _, leftover := range []string{path + ".part", path + ".part.json"} {
+		if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+			t.Errorf("%s was not removed", leftover)
+		}
+	}
+}
+
+func TestDownloadResumesPartialFile(t *testing.T) {
+	jobID := uuid.New()
+	fake := &fakeOutputServer{data: []byte("hello world"), etag: `"v1"`}
+	client, path := setupDownloadTest(t, fake)
+
+	if err := os.WriteFile(path+".part", []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveDownloadState(path+".part.json", &downloadState{JobID: jobID.String(), ETag: `"v1"`}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := downloadJobOutput(context.Background(), client, jobID, path, false); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+
+	got, _ := os.ReadFile(path)
+	if string(got) != "hello world" {
+		t.Errorf("output = %q, want %q", got, "hello world")
+	}
+	if want := []string{"bytes=5-"}; !slices.Equal(fake.ranges, want) {
+		t.Errorf("Range headers = %q, want %q", fake.ranges, want)
+	}
+}
+
+func TestDownloadRestartsWhenOutputChanged(t *testing.T) {
+	jobID := uuid.New()
+	fake := &fakeOutputServer{data: []byte("new output"), etag: `"v2"`}
+	client, path := setupDownloadTest(t, fake)
+
+	if err := os.WriteFile(path+".part", []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveDownloadState(path+".part.json", &downloadState{JobID: jobID.String(), ETag: `"v1"`}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := downloadJobOutput(context.Background(), client, jobID, path, false); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+
+	got, _ := os.ReadFile(path)
+	if string(got) != "new output" {
+		t.Errorf("output = %q, want %q", got, "new output")
+	}
+}
+
+func TestDownloadVerifiesDigest(t *testing.T) {
+	data := []byte("checked output")
+	sum := sha256.Sum256(data)
+	good := "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+
+	fake := &fakeOutputServer{data: data, etag: `"v1"`, digest: good}
+	client, path := setupDownloadTest(t, fake)
+
+	if err := downloadJobOutput(context.Background(), client, uuid.New(), path, false); err != nil {
+		t.Fatalf("download with a valid digest: %v", err)
+	}
+
+	fake.digest = "sha-256=:" + base64.StdEncoding.EncodeToString(make([]byte, sha256.Size)) + ":"
+	path = filepath.Join(filepath.Dir(path), "bad.txt")
+
+	err := downloadJobOutput(context.Background(), client, uuid.New(), path, false)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("download with a wrong digest: err = %v, want a checksum mismatch", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("%s exists after a failed download", path)
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		header      string
+		start, size int64
+		ok          bool
+	}{
+		{"bytes 100-199/1000", 100, 1000, true},
+		{"bytes 0-9/*", 0, -1, true},
+		{"bytes */1000", 0, 0, false},
+		{"items 0-9/10", 0, 0, false},
+		{"bytes 10-19/5", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		start, size, ok := parseContentRange(tt.header)
+		if start != tt.start || size != tt.size || ok != tt.ok {
+			t.Errorf("parseContentRange(%q) = %d, %d, %v, want %d, %d, %v", tt.header, start, size, ok, tt.start, tt.size, tt.ok)
+		}
+	}
+}
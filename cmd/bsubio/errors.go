@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/bsubio/bsubio-go"
+)
+
+// errorKind classifies the errors commands return; each kind has its own
+// exit code so that scripts can tell them apart
+type errorKind string
+
+const (
+	kindError        errorKind = "error"
+	kindUsage        errorKind = "usage"
+	kindJobFailed    errorKind = "job_failed"
+	kindJobRunning   errorKind = "job_running"
+	kindNotFound     errorKind = "not_found"
+	kindAuth         errorKind = "auth"
+	kindNetwork      errorKind = "network"
+	kindServer       errorKind = "server"
+	kindTimeout      errorKind = "timeout"
+	kindInterrupted  errorKind = "interrupted"
+	kindIncomplete   errorKind = "incomplete"
+	kindTypesChanged errorKind = "types_changed"
+)
+
+// Exit codes. They are part of the CLI's interface and documented in the
+// README, so existing values must never change.
+const (
+	exitOK           = 0
+	exitError        = 1
+	exitUsage        = 2
+	exitJobFailed    = 3
+	exitJobRunning   = 4
+	exitNotFound     = 5
+	exitAuth         = 6
+	exitNetwork      = 7
+	exitServer       = 8
+	exitIncomplete   = 9
+	exitTypesChanged = 10
+	exitTimeout      = 124
+	exitInterrupted  = 130
+)
+
+var exitCodes = map[errorKind]int{
+	kindError:        exitError,
+	kindUsage:        exitUsage,
+	kindJobFailed:    exitJobFailed,
+	kindJobRunning:   exitJobRunning,
+	kindNotFound:     exitNotFound,
+	kindAuth:         exitAuth,
+	kindNetwork:      exitNetwork,
+	kindServer:       exitServer,
+	kindTimeout:      exitTimeout,
+	kindInterrupted:  exitInterrupted,
+	kindIncomplete:   exitIncomplete,
+	kindTypesChanged: exitTypesChanged,
+}
+
+// cliError is an error of a known kind, optionally about a single job
+type cliError struct {
+	Kind  errorKind
+	JobID string
+	Err   error
+}
+
+func (e *cliError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *cliError) Unwrap() error {
+	return e.Err
+}
+
+// errorf returns an error of the given kind
+func errorf(kind errorKind, format string, args ...any) error {
+	return &cliError{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+// usageErrorf returns an error about invalid flags or arguments
+func usageErrorf(format string, args ...any) error {
+	return errorf(kindUsage, format, args...)
+}
+
+// usageError marks a flag parsing error as a usage error
+func usageError(err error) error {
+	return &cliError{Kind: kindUsage, Err: err}
+}
+
+// jobFailedError returns the error for a job that finished with a failure
+func jobFailedError(jobID bsubio.JobId, message *string) error {
+	err := fmt.Errorf("job failed")
+	if message != nil && *message != "" {
+		err = fmt.Errorf("job failed: %s", *message)
+	}
+	return &cliError{Kind: kindJobFailed, JobID: jobID.String(), Err: err}
+}
+
+// httpStatusError is returned when the API answers with an unexpected
+// HTTP status code
+type httpStatusError struct {
+	StatusCode int
+	Msg        string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("%s: HTTP %d", e.Msg, e.StatusCode)
+}
+
+// httpErrorf returns an httpStatusError, formatted as "<msg>: HTTP <code>"
+func httpErrorf(statusCode int, format string, args ...any) error {
+	return &httpStatusError{StatusCode: statusCode, Msg: fmt.Sprintf(format, args...)}
+}
+
+// classifyError returns the kind of an error
+func classifyError(err error) errorKind {
+	cause := context.Cause(getContext())
+	switch {
+	case errors.Is(cause, errInterrupted):
+		return kindInterrupted
+	case errors.Is(cause, errTimedOut):
+		return kindTimeout
+	}
+
+	var cliErr *cliError
+	if errors.As(err, &cliErr) {
+		return cliErr.Kind
+	}
+
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return kindForStatus(statusErr.StatusCode)
+	}
+
+	var throttled *throttledError
+	if errors.As(err, &throttled) {
+		return kindServer
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return kindNetwork
+	}
+
+	return kindError
+}
+
+// kindForStatus maps an HTTP status code to an error kind
+func kindForStatus(code int) errorKind {
+	switch {
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return kindAuth
+	case code == http.StatusNotFound || code == http.StatusGone:
+		return kindNotFound
+	case code == http.StatusTooManyRequests || code >= 500:
+		return kindServer
+	default:
+		return kindError
+	}
+}
+
+// reportError prints an error on stderr, as text or as JSON with
+// --json-errors, and returns the exit code for it
+func reportError(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+
+	kind := classifyError(err)
+	code := exitCodes[kind]
+
+	message := err.Error()
+	switch kind {
+	case kindInterrupted:
+		message = "interrupted"
+	case kindTimeout:
+		message = context.Cause(getContext()).Error()
+	}
+
+	if !jsonErrors {
+		if kind == kindInterrupted {
+			fmt.Fprintf(os.Stderr, "Interrupted\n")
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", message)
+		}
+		return code
+	}
+
+	type jsonError struct {
+		Kind       errorKind `json:"kind"`
+		ExitCode   int       `json:"exit_code"`
+		Message    string    `json:"message"`
+		HTTPStatus int       `json:"http_status,omitempty"`
+		JobID      string    `json:"job_id,omitempty"`
+	}
+
+	out := jsonError{Kind: kind, ExitCode: code, Message: message}
+
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		out.HTTPStatus = statusErr.StatusCode
+	}
+	var throttled *throttledError
+	if errors.As(err, &throttled) {
+		out.HTTPStatus = throttled.StatusCode
+	}
+	var cliErr *cliError
+	if errors.As(err, &cliErr) {
+		out.JobID = cliErr.JobID
+	}
+
+	data, _ := json.Marshal(map[string]jsonError{"error": out})
+	fmt.Fprintf(os.Stderr, "%s\n", data)
+	return code
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/bsubio/bsubio-go"
+)
+
+// Every fetched job gets its own directory, holding its output, its logs
+// and its status. status.json is written last, so a directory with one is
+// complete, which is what --mirror relies on to skip jobs.
+const (
+	fetchStatusFile = "status.json"
+	fetchLogsFile   = "logs.txt"
+	fetchOutputName = "output"
+)
+
+// fetchResult is the outcome of fetching a single job
+type fetchResult struct {
+	JobID   string
+	Status  string
+	Skipped bool
+	Err     error
+}
+
+func runFetch(args []string) error {
+	fs := flag.NewFlagSet("fetch", flag.ContinueOnError)
+
+	// Define flags
+	outDir := fs.String("out", ".", "Directory to download the jobs into")
+	status := fs.String("status", "", "Only fetch listed jobs with this status (e.g., finished)")
+	jobType := fs.String("type", "", "Only fetch listed jobs of this type")
+	limit := fs.Int("limit", 20, "Number of recent jobs to list")
+	concurrency := fs.Int("concurrency", 4, "Number of jobs to download in parallel")
+	mirror := fs.Bool("mirror", false, "Skip jobs already fetched into the directory")
+
+	// Custom usage function
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bsubio fetch [options] [<jobid>...]\n\n")
+		fmt.Fprintf(fs.Output(), "Download the outputs and logs of many jobs into a directory\n\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "\nArguments:\n")
+		fmt.Fprintf(fs.Output(), "  jobid    Job IDs (or prefixes, names, @last[~N]) to fetch, or - to read them from stdin\n")
+		fmt.Fprintf(fs.Output(), "           (default: the most recent jobs, see --status, --type and --limit)\n")
+	}
+
+	// Parse flags
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	if *concurrency < 1 {
+		return usageErrorf("concurrency must be at least 1")
+	}
+
+	if *limit < 1 {
+		return usageErrorf("limit must be at least 1")
+	}
+
+	// Get remaining arguments; without any, the recent jobs are listed.
+	// Unlike wait, stdin is only read with "-", so that fetching the recent
+	// jobs from a cron job or a script works without redirecting stdin.
+	remainingArgs := fs.Args()
+
+	var ids []string
+	for _, arg := range remainingArgs {
+		if arg != "-" {
+			ids = append(ids, arg)
+			continue
+		}
+		stdinIDs, err := readJobIDs(os.Stdin)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, stdinIDs...)
+	}
+
+	if len(remainingArgs) > 0 && len(ids) == 0 {
+		return usageErrorf("no job IDs given")
+	}
+
+	// Create client
+	client, err := createClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := getContext()
+
+	jobIDs, err := resolveJobIDs(ctx, client, ids)
+	if err != nil {
+		return err
+	}
+
+	// Listed jobs come with their status; given IDs are looked up by the workers
+	// An incomplete list is fetched, then reported
+	var (
+		listed  []bsubio.Job
+		listErr error
+	)
+	if len(remainingArgs) == 0 {
+		listed, listErr = listJobs(ctx, client, jobFilter{Status: *status, Type: *jobType}, *limit)
+		if listErr != nil && classifyError(listErr) != kindIncomplete {
+			return listErr
+		}
+		for _, job := range listed {
+			if job.Id != nil {
+				jobIDs = append(jobIDs, *job.Id)
+			}
+		}
+	}
+
+	if len(jobIDs) == 0 {
+		fmt.Fprintf(os.Stderr, "No jobs to fetch\n")
+		return listErr
+	}
+
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	f := &fetcher{
+		client: client,
+		outDir: *outDir,
+		mirror: *mirror,
+		listed: make(map[bsubio.JobId]*bsubio.Job),
+	}
+	for i := range listed {
+		if listed[i].Id != nil {
+			f.listed[*listed[i].Id] = &listed[i]
+		}
+	}
+	if types, err := fetchTypes(ctx, client); err == nil {
+		f.types = types
+	}
+
+	fmt.Fprintf(os.Stderr, "Fetching %d job(s) into %s (concurrency %d)\n", len(jobIDs), *outDir, *concurrency)
+
+	results := make([]fetchResult, len(jobIDs))
+	work := make(chan int)
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		done int
+	)
+
+	for w := 0; w < *concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				results[i] = f.fetch(ctx, jobIDs[i])
+
+				mu.Lock()
+				done++
+				if results[i].Err != nil {
+					fmt.Fprintf(os.Stderr, "[%d/%d] %s: %v\n", done, len(jobIDs), jobIDs[i], results[i].Err)
+				} else {
+					fmt.Fprintf(os.Stderr, "[%d/%d] %s: %s\n", done, len(jobIDs), jobIDs[i], results[i].Status)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i := range jobIDs {
+		select {
+		case work <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var fetched, skipped, failed int
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			failed++
+		case r.Skipped:
+			skipped++
+		default:
+			fetched++
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Fetched: %d, skipped: %d, failed: %d\n", fetched, skipped, failed)
+
+	if failed > 0 {
+		return fmt.Errorf("failed to fetch %d of %d job(s)", failed, len(results))
+	}
+
+	return listErr
+}
+
+// fetcher downloads jobs into per-job directories
+type fetcher struct {
+	client *bsubio.BsubClient
+	outDir string
+	mirror bool
+	listed map[bsubio.JobId]*bsubio.Job
+	types  []bsubio.ProcessingType
+}
+
+// fetch downloads the output, logs and status of a job into its directory
+func (f *fetcher) fetch(ctx context.Context, jobID bsubio.JobId) fetchResult {
+	result := fetchResult{JobID: jobID.String()}
+	dir := filepath.Join(f.outDir, jobID.String())
+
+	if f.mirror && fetchedBefore(dir) {
+		result.Status = "already fetched, skipped"
+		result.Skipped = true
+		return result
+	}
+
+	job, ok := f.listed[jobID]
+	if !ok {
+		var err error
+		job, err = getJob(ctx, f.client, jobID)
+		if err != nil {
+			result.Err = err
+			return result
+		}
+	}
+
+	status := ""
+	if job.Status != nil {
+		status = string(*job.Status)
+	}
+	result.Status = status
+
+	// Outputs and logs are only complete once the job is
+	if status != string(bsubio.JobStatusFinished) && status != string(bsubio.JobStatusFailed) {
+		result.Status = status + ", skipped"
+		result.Skipped = true
+		return result
+	}
+	recordJobStatus(job)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		result.Err = fmt.Errorf("failed to create job directory: %w", err)
+		return result
+	}
+
+	if status == string(bsubio.JobStatusFinished) {
+		outPath := filepath.Join(dir, fetchOutputName+"."+typeExtension(f.types, derefString(job.Type)))
+		if err := downloadJobOutput(ctx, f.client, jobID, outPath, false); err != nil {
+			result.Err = err
+			return result
+		}
+	}
+
+	if err := writeJobLogs(ctx, f.client, jobID, filepath.Join(dir, fetchLogsFile)); err != nil {
+		result.Err = err
+		return result
+	}
+
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		result.Err = fmt.Errorf("failed to marshal job status: %w", err)
+		return result
+	}
+
+	err = writeFileAtomic(filepath.Join(dir, fetchStatusFile), func(w io.Writer) error {
+		_, err := w.Write(append(data, '\n'))
+		return err
+	})
+	if err != nil {
+		result.Err = fmt.Errorf("failed to write job status: %w", err)
+	}
+
+	return result
+}
+
+// fetchedBefore reports whether a job directory holds a completed fetch
+func fetchedBefore(dir string) bool {
+	data, err := os.ReadFile(filepath.Join(dir, fetchStatusFile))
+	if err != nil {
+		return false
+	}
+
+	var job bsubio.Job
+	if err := json.Unmarshal(data, &job); err != nil || job.Status == nil {
+		return false
+	}
+
+	return *job.Status == bsubio.JobStatusFinished || *job.Status == bsubio.JobStatusFailed
+}
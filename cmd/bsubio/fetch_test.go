@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bsubio/bsubio-go"
+	"github.com/google/uuid"
+)
+
+func TestFetcher(t *testing.T) {
+	var types []bsubio.ProcessingType
+	if err := json.Unmarshal([]byte(`[{"type": "pdf/extract", "output": {"ext": "txt"}}]`), &types); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		status      bsubio.JobStatus
+		mirror      bool
+		before      map[string]string // files in the job directory before fetching
+		wantStatus  string
+		wantSkipped bool
+		wantFiles   map[string]string // files in the job directory after fetching, "" for any content
+		wantNoDir   bool
+		wantNoReqs  bool
+	}{
+		{
+			name:       "finished",
+			status:     bsubio.JobStatusFinished,
+			wantStatus: "finished",
+			wantFiles:  map[string]string{"output.txt": "new output", "logs.txt": "job logs", "status.json": ""},
+		},
+		{
+			name:       "failed",
+			status:     bsubio.JobStatusFailed,
+			wantStatus: "failed",
+			wantFiles:  map[string]string{"logs.txt": "job logs", "status.json": ""},
+		},
+		{
+			name:        "pending",
+			status:      bsubio.JobStatusPending,
+			wantStatus:  "pending, skipped",
+			wantSkipped: true,
+			wantNoDir:   true,
+		},
+		{
+			name:       "overwrites without mirror",
+			status:     bsubio.JobStatusFinished,
+			before:     map[string]string{"output.txt": "old output", "logs.txt": "old logs", "status.json": `{"status": "finished"}`},
+			wantStatus: "finished",
+			wantFiles:  map[string]string{"output.txt": "new output", "logs.txt": "job logs"},
+		},
+		{
+			name:        "mirror skips a complete directory",
+			status:      bsubio.JobStatusFinished,
+			mirror:      true,
+			before:      map[string]string{"output.txt": "old output", "status.json": `{"status": "finished"}`},
+			wantStatus:  "already fetched, skipped",
+			wantSkipped: true,
+			wantFiles:   map[string]string{"output.txt": "old output"},
+			wantNoReqs:  true,
+		},
+		{
+			name:       "mirror refetches an incomplete directory",
+			status:     bsubio.JobStatusFinished,
+			mirror:     true,
+			before:     map[string]string{"output.txt": "old output"},
+			wantStatus: "finished",
+			wantFiles:  map[string]string{"output.txt": "new output", "logs.txt": "job logs", "status.json": ""},
+		},
+		{
+			name:       "mirror refetches a job that was still running",
+			status:     bsubio.JobStatusFinished,
+			mirror:     true,
+			before:     map[string]string{"status.json": `{"status": "processing"}`},
+			wantStatus: "finished",
+			wantFiles:  map[string]string{"output.txt": "new output", "logs.txt": "job logs"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+			id := uuid.New()
+			jobType := "pdf/extract"
+			status := tt.status
+
+			var requests atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				switch {
+				case strings.HasSuffix(r.URL.Path, "/output"):
+					w.Header().Set("Content-Type", "text/plain")
+					_, _ = fmt.Fprint(w, "new output")
+				case strings.HasSuffix(r.URL.Path, "/logs"):
+					w.Header().Set("Content-Type", "text/plain")
+					_, _ = fmt.Fprint(w, "job logs")
+				default:
+					jobResponse(bsubio.Job{Id: &id, Type: &jobType, Status: &status})(w)
+				}
+			}))
+			defer srv.Close()
+
+			client, err := bsubio.NewBsubClient(bsubio.Config{APIKey: "test", BaseURL: srv.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			outDir := t.TempDir()
+			dir := filepath.Join(outDir, id.String())
+			for name, content := range tt.before {
+				if err := os.MkdirAll(dir, 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			f := &fetcher{
+				client: client,
+				outDir: outDir,
+				mirror: tt.mirror,
+				types:  types,
+			}
+			result := f.fetch(context.Background(), id)
+
+			if result.Err != nil {
+				t.Fatalf("fetch() failed: %v", result.Err)
+			}
+			if result.Status != tt.wantStatus || result.Skipped != tt.wantSkipped {
+				t.Errorf("fetch() = %q (skipped %v), want %q (skipped %v)", result.Status, result.Skipped, tt.wantStatus, tt.wantSkipped)
+			}
+			if tt.wantNoReqs && requests.Load() > 0 {
+				t.Errorf("fetch() made %d request(s), want none", requests.Load())
+			}
+
+			if tt.wantNoDir {
+				if _, err := os.Stat(dir); !os.IsNotExist(err) {
+					t.Errorf("job directory was created")
+				}
+				return
+			}
+
+			for name, want := range tt.wantFiles {
+				data, err := os.ReadFile(filepath.Join(dir, name))
+				if err != nil {
+					t.Errorf("%s: %v", name, err)
+					continue
+				}
+				if want != "" && string(data) != want {
+					t.Errorf("%s = %q, want %q", name, data, want)
+				}
+			}
+			if tt.status == bsubio.JobStatusFailed {
+				if _, err := os.Stat(filepath.Join(dir, "output.txt")); !os.IsNotExist(err) {
+					t.Errorf("output of a failed job was written")
+				}
+			}
+			if !tt.wantSkipped && !fetchedBefore(dir) {
+				t.Errorf("status.json does not record a completed fetch")
+			}
+		})
+	}
+}
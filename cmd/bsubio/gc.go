@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/bsubio/bsubio-go"
+)
+
+// gc deletes finished and failed jobs according to retention rules. A job
+// is kept if it is among the keep_last most recent jobs of its group, or
+// if it is younger than its maximum age: keep_failed for failed jobs when
+// set, max_age otherwise. Jobs no rule applies to are kept, and so are
+// jobs still pending or running.
+
+// gcRules are retention rules, as found in the config file. Unset rules
+// are inherited from the global rules; set to 0 (or "0" for ages), they
+// switch a global rule off for a type.
+type gcRules struct {
+	KeepLast   *int   `json:"keep_last,omitempty"`
+	MaxAge     string `json:"max_age,omitempty"`
+	KeepFailed string `json:"keep_failed,omitempty"`
+}
+
+// GCConfig holds the retention rules of gc. Types override the global
+// rules for their jobs, rule by rule.
+type GCConfig struct {
+	gcRules
+	Types map[string]gcRules `json:"types,omitempty"`
+}
+
+// merge returns the rules with the ones set in o replacing them
+func (r gcRules) merge(o gcRules) gcRules {
+	if o.KeepLast != nil {
+		r.KeepLast = o.KeepLast
+	}
+	if o.MaxAge != "" {
+		r.MaxAge = o.MaxAge
+	}
+	if o.KeepFailed != "" {
+		r.KeepFailed = o.KeepFailed
+	}
+	return r
+}
+
+// empty reports whether no rule is set
+func (r gcRules) empty() bool {
+	return r == gcRules{}
+}
+
+// gcPolicy is the parsed form of gcRules
+type gcPolicy struct {
+	keepLast   int
+	maxAge     time.Duration
+	keepFailed time.Duration
+}
+
+func (r gcRules) parse() (gcPolicy, error) {
+	var p gcPolicy
+	if r.KeepLast != nil {
+		if *r.KeepLast < 0 {
+			return p, fmt.Errorf("keep_last must not be negative")
+		}
+		p.keepLast = *r.KeepLast
+	}
+
+	var err error
+	if r.MaxAge != "" {
+		if p.maxAge, err = parseAge(r.MaxAge); err != nil {
+			return p, fmt.Errorf("invalid max_age: %w", err)
+		}
+	}
+	if r.KeepFailed != "" {
+		if p.keepFailed, err = parseAge(r.KeepFailed); err != nil {
+			return p, fmt.Errorf("invalid keep_failed: %w", err)
+		}
+	}
+
+	return p, nil
+}
+
+// maxAgeFor returns the maximum age of a job, or 0 if none applies
+func (p gcPolicy) maxAgeFor(job *bsubio.Job) time.Duration {
+	if derefStatus(job.Status) == bsubio.JobStatusFailed && p.keepFailed > 0 {
+		return p.keepFailed
+	}
+	return p.maxAge
+}
+
+func runGC(args []string) error {
+	fs := flag.NewFlagSet("gc", flag.ContinueOnError)
+
+	// Define flags
+	keepLast := fs.Int("keep-last", 0, "Keep the most recent jobs, this many of them")
+	maxAge := fs.String("max-age", "", "Delete jobs older than this (e.g., 14d)")
+	keepFailed := fs.String("keep-failed", "", "Keep failed jobs this long instead of --max-age (e.g., 30d)")
+	archiveDir := fs.String("download-before-delete", "", "Download the output and logs of each job into this directory before deleting it")
+	dryRun := fs.Bool("dry-run", false, "List the jobs that would be deleted without deleting them")
+	yes := fs.Bool("yes", false, "Do not ask for confirmation")
+	fs.BoolVar(yes, "y", false, "Same as --yes")
+	concurrency := fs.Int("concurrency", 4, "Number of jobs to delete in parallel")
+
+	// Custom usage function
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bsubio gc [options]\n\n")
+		fmt.Fprintf(fs.Output(), "Delete finished and failed jobs according to retention rules\n\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "\nRules given as options replace the global rules of the config file;\n")
+		fmt.Fprintf(fs.Output(), "per-type rules from the config file still apply. See 'bsubio help gc'.\n")
+	}
+
+	// Parse flags
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return usageErrorf("expected 0 arguments, got %d", fs.NArg())
+	}
+
+	if *concurrency < 1 {
+		return usageErrorf("concurrency must be at least 1")
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	rules := GCConfig{}
+	if config.GC != nil {
+		rules = *config.GC
+	}
+	flagRules := gcRules{MaxAge: *maxAge, KeepFailed: *keepFailed}
+	if *keepLast != 0 {
+		flagRules.KeepLast = keepLast
+	}
+	if !flagRules.empty() {
+		rules.gcRules = flagRules
+	}
+
+	if rules.empty() && len(rules.Types) == 0 {
+		fs.Usage()
+		return usageErrorf("no retention rules given (use --keep-last, --max-age or --keep-failed, or set them in the config file)")
+	}
+
+	// Create client
+	client, err := createClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := getContext()
+
+	// Jobs past a capped list would be silently kept, so gc refuses to run
+	jobs, err := listJobs(ctx, client, jobFilter{}, 0)
+	if err != nil {
+		if classifyError(err) == kindIncomplete {
+			return errorf(kindIncomplete, "%v; nothing was deleted", err)
+		}
+		return err
+	}
+
+	doomed, err := planGC(jobs, rules, time.Now())
+	if err != nil {
+		return usageError(err)
+	}
+
+	if len(doomed) == 0 {
+		fmt.Fprintf(os.Stderr, "No jobs to delete (%d job(s) checked)\n", len(jobs))
+		return nil
+	}
+
+	jobIDs := make([]bsubio.JobId, len(doomed))
+	var freed int64
+	for i, job := range doomed {
+		jobIDs[i] = *job.Id
+		if job.DataSize != nil {
+			freed += *job.DataSize
+		}
+	}
+
+	if *dryRun {
+		printBulkJobs(os.Stdout, jobIDs, doomed, 0)
+		printGCSummary(doomed)
+		fmt.Fprintf(os.Stderr, "Would delete %d of %d job(s), freeing %s\n", len(doomed), len(jobs), formatBytes(freed))
+		return nil
+	}
+
+	action := rmAction
+	if *archiveDir != "" {
+		action, err = archivingAction(ctx, client, *archiveDir, doomed)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(jobIDs) > bulkConfirmThreshold && !*yes {
+		if err := confirmBulk(action, jobIDs, doomed, false); err != nil {
+			return err
+		}
+	}
+
+	if err := runBulkWorkers(ctx, client, action, jobIDs, *concurrency); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Freed %s\n", formatBytes(freed))
+	return nil
+}
+
+// planGC returns the jobs the rules delete, most recent first
+func planGC(jobs []bsubio.Job, rules GCConfig, now time.Time) ([]bsubio.Job, error) {
+	global, err := rules.gcRules.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	policies := make(map[string]gcPolicy)
+	for t, r := range rules.Types {
+		if policies[t], err = rules.gcRules.merge(r).parse(); err != nil {
+			return nil, fmt.Errorf("type %s: %w", t, err)
+		}
+	}
+
+	sorted := slices.Clone(jobs)
+	sortJobs(sorted, "created", false)
+
+	// keep_last counts the jobs of each type with its own keep_last
+	// separately, and the jobs of all other types together
+	seen := make(map[string]int)
+
+	var doomed []bsubio.Job
+	for _, job := range sorted {
+		if job.Id == nil || !jobDone(&job) {
+			continue
+		}
+
+		jobType := derefString(job.Type)
+		policy, ok := policies[jobType]
+		if !ok {
+			policy = global
+		}
+
+		group := ""
+		if rules.Types[jobType].KeepLast != nil {
+			group = jobType
+		}
+		rank := seen[group]
+		seen[group]++
+
+		maxAge := policy.maxAgeFor(&job)
+		if policy.keepLast == 0 && maxAge == 0 {
+			continue
+		}
+		if policy.keepLast > 0 && rank < policy.keepLast {
+			continue
+		}
+		if maxAge > 0 && (job.CreatedAt == nil || now.Sub(*job.CreatedAt) <= maxAge) {
+			continue
+		}
+
+		doomed = append(doomed, job)
+	}
+
+	return doomed, nil
+}
+
+// printGCSummary prints how many jobs and bytes are deleted per type
+func printGCSummary(doomed []bsubio.Job) {
+	type typeSummary struct {
+		jobs  int
+		bytes int64
+	}
+	byType := make(map[string]*typeSummary)
+	for _, job := range doomed {
+		s, ok := byType[derefString(job.Type)]
+		if !ok {
+			s = &typeSummary{}
+			byType[derefString(job.Type)] = s
+		}
+		s.jobs++
+		if job.DataSize != nil {
+			s.bytes += *job.DataSize
+		}
+	}
+
+	types := make([]string, 0, len(byType))
+	for t := range byType {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	fmt.Fprintln(os.Stderr)
+	for _, t := range types {
+		fmt.Fprintf(os.Stderr, "  %-30s %6d job(s) %10s\n", t, byType[t].jobs, formatBytes(byType[t].bytes))
+	}
+	fmt.Fprintln(os.Stderr)
+}
+
+// archivingAction returns an action that downloads each job into dir, like
+// fetch does, and deletes it only once that succeeded
+func archivingAction(ctx context.Context, client *bsubio.BsubClient, dir string, jobs []bsubio.Job) (*bulkAction, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	// Jobs archived by an earlier, interrupted run are not downloaded again
+	f := &fetcher{
+		client: client,
+		outDir: dir,
+		mirror: true,
+		listed: make(map[bsubio.JobId]*bsubio.Job),
+	}
+	for i := range jobs {
+		f.listed[*jobs[i].Id] = &jobs[i]
+	}
+	if types, err := fetchTypes(ctx, client); err == nil {
+		f.types = types
+	}
+
+	return &bulkAction{
+		Verb:    "archive and delete",
+		Done:    "Archived and deleted",
+		Applies: rmAction.Applies,
+		Run: func(ctx context.Context, client *bsubio.BsubClient, jobID bsubio.JobId) error {
+			if result := f.fetch(ctx, jobID); result.Err != nil {
+				return fmt.Errorf("failed to archive job into %s: %w", filepath.Join(dir, jobID.String()), result.Err)
+			}
+			return deleteJob(ctx, client, jobID)
+		},
+	}, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bsubio/bsubio-go"
+	"github.com/google/uuid"
+)
+
+func TestPlanGC(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	// One job per day going back, named by type and age in days
+	job := func(jobType string, days int, status bsubio.JobStatus) bsubio.Job {
+		id := uuid.NewSHA1(uuid.Nil, []byte(fmt.Sprintf("%s-%d", jobType, days)))
+		created := now.Add(-time.Duration(days) * 24 * time.Hour)
+		return bsubio.Job{Id: &id, Type: &jobType, Status: &status, CreatedAt: &created}
+	}
+	n := func(i int) *int { return &i }
+	name := func(j bsubio.Job) string {
+		return fmt.Sprintf("%s-%d", *j.Type, int(now.Sub(*j.CreatedAt).Hours()/24))
+	}
+
+	jobs := []bsubio.Job{
+		job("a", 1, bsubio.JobStatusFinished),
+		job("a", 5, bsubio.JobStatusFailed),
+		job("a", 10, bsubio.JobStatusFinished),
+		job("a", 20, bsubio.JobStatusFailed),
+		job("a", 40, bsubio.JobStatusPending),
+		job("b", 2, bsubio.JobStatusFinished),
+		job("b", 15, bsubio.JobStatusFinished),
+		job("b", 30, bsubio.JobStatusFinished),
+	}
+
+	tests := []struct {
+		name  string
+		rules GCConfig
+		want  []string
+	}{
+		{
+			"keep last",
+			GCConfig{gcRules: gcRules{KeepLast: n(4)}},
+			[]string{"b-15", "a-20", "b-30"},
+		},
+		{
+			"max age",
+			GCConfig{gcRules: gcRules{MaxAge: "7d"}},
+			[]string{"a-10", "b-15", "a-20", "b-30"},
+		},
+		{
+			"keep failed longer",
+			GCConfig{gcRules: gcRules{MaxAge: "7d", KeepFailed: "30d"}},
+			[]string{"a-10", "b-15", "b-30"},
+		},
+		{
+			"keep last or young enough",
+			GCConfig{gcRules: gcRules{KeepLast: n(2), MaxAge: "3d"}},
+			[]string{"a-5", "a-10", "b-15", "a-20", "b-30"},
+		},
+		{
+			"type override",
+			GCConfig{gcRules: gcRules{MaxAge: "7d"}, Types: map[string]gcRules{"b": {MaxAge: "20d"}}},
+			[]string{"a-10", "a-20", "b-30"},
+		},
+		{
+			"type with its own keep last",
+			GCConfig{gcRules: gcRules{KeepLast: n(1)}, Types: map[string]gcRules{"b": {KeepLast: n(2)}}},
+			[]string{"a-5", "a-10", "a-20", "b-30"},
+		},
+		{
+			"type switching global rules off",
+			GCConfig{gcRules: gcRules{KeepLast: n(1), MaxAge: "3d"}, Types: map[string]gcRules{"b": {KeepLast: n(0), MaxAge: "0"}}},
+			[]string{"a-5", "a-10", "a-20"},
+		},
+		{
+			"type only rules",
+			GCConfig{Types: map[string]gcRules{"b": {MaxAge: "10d"}}},
+			[]string{"b-15", "b-30"},
+		},
+	}
+
+	for _, tt := range tests {
+		doomed, err := planGC(jobs, tt.rules, now)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		var got []string
+		for _, j := range doomed {
+			got = append(got, name(j))
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: planGC() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := planGC(jobs, GCConfig{gcRules: gcRules{MaxAge: "soon"}}, now); err == nil {
+		t.Errorf("planGC() with an invalid max_age succeeded, want an error")
+	}
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bsubio/bsubio-go"
+)
+
+// The job history is an append-only JSONL file next to the config file.
+// A line is written when a job is submitted and another one, carrying only
+// the job ID and the new fields, when the CLI sees the job reach a final
+// status. Reading the file merges the lines of each job into one entry.
+
+// historyEntry describes a job submitted from this machine
+type historyEntry struct {
+	JobID        string    `json:"job_id"`
+	Name         string    `json:"name,omitempty"`
+	Type         string    `json:"type,omitempty"`
+	Input        string    `json:"input,omitempty"`
+	InputSHA256  string    `json:"input_sha256,omitempty"`
+	Size         int64     `json:"size,omitempty"`
+	SubmittedAt  time.Time `json:"submitted_at,omitzero"`
+	BaseURL      string    `json:"base_url,omitempty"`
+	Status       string    `json:"status,omitempty"`
+	FinishedAt   time.Time `json:"finished_at,omitzero"`
+	ErrorMessage string    `json:"error_message,omitempty"`
+
+	// nameLine is the line of the history that last named the job, so a
+	// name given to an older job, e.g. on a cache hit, still moves to it
+	nameLine int
+}
+
+var historyColumns = []outputColumn[*historyEntry]{
+	{"job_id", func(e *historyEntry) string { return e.JobID }},
+	{"name", func(e *historyEntry) string { return e.Name }},
+	{"type", func(e *historyEntry) string { return e.Type }},
+	{"input", func(e *historyEntry) string { return e.Input }},
+	{"input_sha256", func(e *historyEntry) string { return e.InputSHA256 }},
+	{"size", func(e *historyEntry) string { return fmt.Sprint(e.Size) }},
+	{"submitted_at", func(e *historyEntry) string { return csvTime(&e.SubmittedAt) }},
+	{"base_url", func(e *historyEntry) string { return e.BaseURL }},
+	{"status", func(e *historyEntry) string { return e.Status }},
+	{"finished_at", func(e *historyEntry) string { return csvTime(&e.FinishedAt) }},
+	{"error_message", func(e *historyEntry) string { return e.ErrorMessage }},
+}
+
+// merge copies the fields set in a later line of the same job
+func (e *historyEntry) merge(o historyEntry) {
+	if o.Name != "" {
+		e.Name = o.Name
+	}
+	if o.Type != "" {
+		e.Type = o.Type
+	}
+	if o.Input != "" {
+		e.Input = o.Input
+	}
+	if o.InputSHA256 != "" {
+		e.InputSHA256 = o.InputSHA256
+	}
+	if o.Size != 0 {
+		e.Size = o.Size
+	}
+	if !o.SubmittedAt.IsZero() {
+		e.SubmittedAt = o.SubmittedAt
+	}
+	if o.BaseURL != "" {
+		e.BaseURL = o.BaseURL
+	}
+	if o.Status != "" {
+		e.Status = o.Status
+	}
+	if !o.FinishedAt.IsZero() {
+		e.FinishedAt = o.FinishedAt
+	}
+	if o.ErrorMessage != "" {
+		e.ErrorMessage = o.ErrorMessage
+	}
+}
+
+// historyMu serializes appends from concurrent workers
+var historyMu sync.Mutex
+
+// getHistoryPath returns the path to the job history file
+func getHistoryPath() (string, error) {
+	configPath, err := getConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(configPath), "history.jsonl"), nil
+}
+
+// appendHistory adds a line to the job history. Failing to record history
+// never fails the command, so errors are only reported as warnings.
+func appendHistory(entry historyEntry) {
+	if err := writeHistoryLine(entry); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to update job history: %v\n", err)
+	}
+}
+
+func writeHistoryLine(entry historyEntry) error {
+	path, err := getHistoryPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(append(data, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// recordSubmission adds a newly submitted job to the history. inputPath is
+// the file the input was read from, or empty for streams such as stdin.
+func recordSubmission(job *bsubio.Job, jobType, inputPath, inputSHA256 string, size int64) {
+	if job == nil || job.Id == nil {
+		return
+	}
+
+	if inputPath != "" {
+		if abs, err := filepath.Abs(inputPath); err == nil {
+			inputPath = abs
+		}
+	}
+
+	entry := historyEntry{
+		JobID:       job.Id.String(),
+		Type:        jobType,
+		Input:       inputPath,
+		InputSHA256: inputSHA256,
+		Size:        size,
+		SubmittedAt: time.Now().UTC(),
+		Status:      "submitted",
+	}
+
+	if config, err := loadConfig(); err == nil {
+		entry.BaseURL = config.BaseURL
+	}
+
+	appendHistory(entry)
+
+	historyStatuses.Lock()
+	if historyStatuses.byID != nil {
+		historyStatuses.byID[entry.JobID] = entry.Status
+	}
+	historyStatuses.Unlock()
+}
+
+// recordJobName gives a local name to a job
+func recordJobName(jobID, name string) {
+	if name == "" {
+		return
+	}
+
+	appendHistory(historyEntry{JobID: jobID, Name: name})
+}
+
+// historyStatuses holds the status of every job submitted from this
+// machine, read from the history on first use, so that commands recording
+// the status of many jobs do not read the whole history for each of them
+var historyStatuses struct {
+	sync.Mutex
+	byID map[string]string
+}
+
+// recordJobStatus records the final status of a job in the history. Jobs
+// that are still running, that were not submitted from this machine or
+// whose final status is already known are ignored.
+func recordJobStatus(job *bsubio.Job) {
+	if job == nil || job.Id == nil || job.Status == nil {
+		return
+	}
+
+	if *job.Status != bsubio.JobStatusFinished && *job.Status != bsubio.JobStatusFailed {
+		return
+	}
+
+	historyStatuses.Lock()
+	defer historyStatuses.Unlock()
+
+	if historyStatuses.byID == nil {
+		entries, err := loadHistory()
+		if err != nil {
+			return
+		}
+		historyStatuses.byID = make(map[string]string, len(entries))
+		for _, e := range entries {
+			// Jobs only named here were submitted elsewhere
+			if !e.SubmittedAt.IsZero() {
+				historyStatuses.byID[e.JobID] = e.Status
+			}
+		}
+	}
+
+	known, ok := historyStatuses.byID[job.Id.String()]
+	if !ok || known == string(*job.Status) {
+		return
+	}
+	historyStatuses.byID[job.Id.String()] = string(*job.Status)
+
+	entry := historyEntry{
+		JobID:        job.Id.String(),
+		Status:       string(*job.Status),
+		FinishedAt:   time.Now().UTC(),
+		ErrorMessage: derefString(job.ErrorMessage),
+	}
+	if job.FinishedAt != nil {
+		entry.FinishedAt = job.FinishedAt.UTC()
+	}
+
+	appendHistory(entry)
+}
+
+// loadHistory reads the job history, oldest submission first
+func loadHistory() ([]*historyEntry, error) {
+	path, err := getHistoryPath()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read job history: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	byID := make(map[string]*historyEntry)
+	var entries []*historyEntry
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		var line historyEntry
+		// Skip lines that were cut short by a crash
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil || line.JobID == "" {
+			continue
+		}
+
+		e, ok := byID[line.JobID]
+		if ok {
+			e.merge(line)
+		} else {
+			e = &line
+			byID[line.JobID] = e
+			entries = append(entries, e)
+		}
+		if line.Name != "" {
+			e.nameLine = n
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read job history: %w", err)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].SubmittedAt.Before(entries[j].SubmittedAt)
+	})
+
+	return entries, nil
+}
+
+// hashingReader computes the SHA-256 and size of the data read through it
+type hashingReader struct {
+	r    io.Reader
+	hash hash.Hash
+	size int64
+}
+
+func newHashingReader(r io.Reader) *hashingReader {
+	return &hashingReader{r: r, hash: sha256.New()}
+}
+
+func (h *hashingReader) Read(b []byte) (int, error) {
+	n, err := h.r.Read(b)
+	h.hash.Write(b[:n])
+	h.size += int64(n)
+	return n, err
+}
+
+// Sum returns the hex encoded SHA-256 of everything read so far
+func (h *hashingReader) Sum() string {
+	return hex.EncodeToString(h.hash.Sum(nil))
+}
+
+func runHistory(args []string) error {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+
+	// Define flags
+	file := fs.String("file", "", "Only show jobs that processed this file (matched by content, or by path if it no longer exists)")
+	jobType := fs.String("type", "", "Only show jobs of this type")
+	status := fs.String("status", "", "Only show jobs with this status (submitted, finished, failed)")
+	since := fs.String("since", "", "Only show jobs submitted after this time (e.g., 2h, 7d, 2025-01-31)")
+	limit := fs.Int("limit", 20, "Maximum number of jobs to show (0 for all)")
+	out := addOutputFlags(fs)
+
+	// Custom usage function
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bsubio history [options]\n\n")
+		fmt.Fprintf(fs.Output(), "Show jobs submitted from this machine, most recent last\n\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	// Parse flags
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return usageErrorf("expected 0 arguments, got %d", fs.NArg())
+	}
+
+	if err := out.check(); err != nil {
+		return err
+	}
+
+	var sinceTime time.Time
+	if *since != "" {
+		var err error
+		if sinceTime, err = parseTimeArg(*since, time.Now()); err != nil {
+			return usageErrorf("invalid --since: %w", err)
+		}
+	}
+
+	entries, err := loadHistory()
+	if err != nil {
+		return err
+	}
+
+	// Files are matched by content, so renamed or moved copies are found too
+	var fileHash, filePath string
+	if *file != "" {
+		if abs, err := filepath.Abs(*file); err == nil {
+			filePath = abs
+		}
+		if fileExists(*file) {
+			fileHash, err = hashFile(*file)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	var matching []*historyEntry
+	for _, e := range entries {
+		if *file != "" {
+			if fileHash != "" && e.InputSHA256 != fileHash {
+				continue
+			}
+			if fileHash == "" && e.Input != filePath {
+				continue
+			}
+		}
+		if *jobType != "" && e.Type != *jobType {
+			continue
+		}
+		if *status != "" && e.Status != *status {
+			continue
+		}
+		// Jobs only named here have no submission time to compare
+		if !sinceTime.IsZero() && e.SubmittedAt.Before(sinceTime) {
+			continue
+		}
+		matching = append(matching, e)
+	}
+
+	if *limit > 0 && len(matching) > *limit {
+		matching = matching[len(matching)-*limit:]
+	}
+
+	if !out.table() {
+		return printList(out, matching, historyColumns)
+	}
+
+	if len(matching) == 0 {
+		fmt.Println("No jobs found in history")
+		return nil
+	}
+
+	fmt.Printf("%-19s %-36s %-16s %-20s %-10s %10s %s\n", "SUBMITTED", "JOB ID", "NAME", "TYPE", "STATUS", "SIZE", "INPUT")
+	fmt.Println("--------------------------------------------------------------------------------")
+
+	for _, e := range matching {
+		// Jobs only named here were not submitted from this machine, so
+		// nothing is known about their submission
+		submitted, size, input := "-", "-", "-"
+		if !e.SubmittedAt.IsZero() {
+			submitted = e.SubmittedAt.Local().Format("2006-01-02 15:04:05")
+			size = formatBytes(e.Size)
+			input = e.Input
+			if input == "" {
+				input = "(stdin)"
+			}
+		}
+
+		fmt.Printf("%-19s %-36s %-16s %-20s %-10s %10s %s\n",
+			submitted,
+			e.JobID,
+			truncate(e.Name, 16),
+			truncate(e.Type, 20),
+			e.Status,
+			size,
+			input)
+	}
+
+	return nil
+}
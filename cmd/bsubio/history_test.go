@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bsubio/bsubio-go"
+	"github.com/google/uuid"
+)
+
+func TestRecordJobStatus(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	// The statuses are cached per process, and each test has its own history
+	historyStatuses.byID = nil
+	t.Cleanup(func() { historyStatuses.byID = nil })
+
+	submitted, named, later := uuid.New(), uuid.New(), uuid.New()
+	appendHistory(historyEntry{JobID: submitted.String(), SubmittedAt: time.Now().UTC(), Status: "submitted"})
+	recordJobName(named.String(), "cached")
+
+	job := func(id uuid.UUID, status bsubio.JobStatus) *bsubio.Job {
+		return &bsubio.Job{Id: &id, Status: &status}
+	}
+
+	recordJobStatus(job(submitted, bsubio.JobStatusProcessing))
+	recordJobStatus(job(submitted, bsubio.JobStatusFinished))
+	recordJobStatus(job(submitted, bsubio.JobStatusFinished))
+	recordJobStatus(job(named, bsubio.JobStatusFinished))
+	recordJobStatus(job(uuid.New(), bsubio.JobStatusFailed))
+
+	// Jobs submitted once the statuses are cached are known too
+	recordSubmission(job(later, bsubio.JobStatusPending), "pdf/extract", "", "", 0)
+	recordJobStatus(job(later, bsubio.JobStatusFailed))
+
+	entries, err := loadHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := make(map[string]string)
+	for _, e := range entries {
+		statuses[e.JobID] = e.Status
+	}
+	want := map[string]string{
+		submitted.String(): "finished",
+		named.String():     "",
+		later.String():     "failed",
+	}
+	for id, status := range want {
+		if statuses[id] != status {
+			t.Errorf("status of %s = %q, want %q", id, statuses[id], status)
+		}
+	}
+	if len(statuses) != len(want) {
+		t.Errorf("history holds %d jobs, want %d", len(statuses), len(want))
+	}
+
+	// A final status already recorded is not recorded again
+	path, err := getHistoryPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), `"status":"finished"`); n != 1 {
+		t.Errorf("history records the finished status %d times, want once", n)
+	}
+}
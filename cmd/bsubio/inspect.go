@@ -0,0 +1,388 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bsubio/bsubio-go"
+)
+
+// inspectReport gathers what is known about a job, for bug reports. Parts
+// that cannot be collected are listed in Errors instead of failing the
+// whole report, since a misbehaving job is what it is meant to debug.
+type inspectReport struct {
+	JobID       string          `json:"job_id"`
+	CollectedAt time.Time       `json:"collected_at"`
+	Job         json.RawMessage `json:"job,omitempty"`
+	Versions    versionInfo     `json:"versions"`
+	Config      *Config         `json:"config,omitempty"`
+	History     *historyEntry   `json:"history,omitempty"`
+	Errors      []string        `json:"errors,omitempty"`
+
+	// secrets, the API key and job tokens, are scrubbed from everything
+	// the report is written with
+	secrets []string
+}
+
+// redactedAPIKey replaces the API key and other secrets in reports
+const redactedAPIKey = "REDACTED"
+
+// secretFieldWords mark the fields of jobs holding secrets, like the
+// upload_token that lets anyone upload the job's input
+var secretFieldWords = []string{"token", "secret", "password", "api_key", "apikey", "private_key", "credential", "authorization"}
+
+// redactMinKeyLength is the length from which API keys are scrubbed from
+// logs and error messages
+const redactMinKeyLength = 8
+
+func runInspect(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ContinueOnError)
+
+	// Define flags
+	bundle := fs.Bool("bundle", false, "Write a .tar.gz debug bundle instead of printing a report")
+	outputFile := fs.String("o", "", "Bundle file path (default: bsubio-<jobid>.tar.gz)")
+	includeOutput := fs.Bool("include-output", false, "Include the job's output in the bundle")
+
+	// Custom usage function
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bsubio inspect [options] <jobid>\n\n")
+		fmt.Fprintf(fs.Output(), "Collect a job's status, logs, versions and local history for bug reports\n\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "\nArguments:\n")
+		fmt.Fprintf(fs.Output(), "  jobid    Job ID, ID prefix, job name or @last[~N]\n")
+	}
+
+	// Parse flags
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	// Get remaining arguments
+	remainingArgs := fs.Args()
+	if len(remainingArgs) != 1 {
+		fs.Usage()
+		return usageErrorf("expected 1 argument, got %d", len(remainingArgs))
+	}
+
+	if !*bundle && (*outputFile != "" || *includeOutput) {
+		return usageErrorf("-o and --include-output require --bundle")
+	}
+
+	// Create client
+	client, err := createClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := getContext()
+
+	jobUUID, err := resolveJobID(ctx, client, remainingArgs[0])
+	if err != nil {
+		return err
+	}
+
+	report := collectInspectReport(ctx, client, jobUUID)
+
+	if !*bundle {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal report: %w", err)
+		}
+		fmt.Println(report.redact(string(data)))
+		return nil
+	}
+
+	path := *outputFile
+	if path == "" {
+		path = fmt.Sprintf("bsubio-%s.tar.gz", jobUUID)
+	}
+
+	if err := writeInspectBundle(ctx, client, report, jobUUID, path, *includeOutput); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Debug bundle saved to %s\n", path)
+	return nil
+}
+
+// collectInspectReport gathers the job's status, the versions, the
+// redacted config and the job's history entry
+func collectInspectReport(ctx context.Context, client *bsubio.BsubClient, jobID bsubio.JobId) *inspectReport {
+	report := &inspectReport{
+		JobID:       jobID.String(),
+		CollectedAt: time.Now().UTC(),
+		Versions:    cliVersionInfo(),
+	}
+
+	fail := func(format string, args ...any) {
+		report.Errors = append(report.Errors, fmt.Sprintf(format, args...))
+	}
+
+	// The raw API response is kept, so fields the CLI does not know about
+	// show up in the report too
+	if resp, err := client.GetJobWithResponse(ctx, jobID); err != nil {
+		fail("failed to get job status: %v", err)
+	} else if resp.StatusCode() != 200 {
+		fail("failed to get job status: HTTP %d", resp.StatusCode())
+	} else if job, secrets, err := redactJobSecrets(resp.Body); err == nil {
+		report.Job = job
+		report.secrets = append(report.secrets, secrets...)
+	}
+
+	if resp, err := client.GetVersionWithResponse(ctx); err != nil {
+		fail("failed to get API version: %v", err)
+	} else if resp.StatusCode() != 200 {
+		fail("failed to get API version: HTTP %d", resp.StatusCode())
+	} else if resp.JSON200 != nil {
+		report.Versions.Server = derefString(resp.JSON200.Version)
+		report.Versions.ServerName = derefString(resp.JSON200.Server)
+		report.Versions.ServerBuild = derefString(resp.JSON200.Build)
+	}
+
+	if config, err := loadConfig(); err != nil {
+		fail("failed to load config: %v", err)
+	} else {
+		if config.APIKey != "" {
+			report.secrets = append(report.secrets, config.APIKey)
+			config.APIKey = redactedAPIKey
+		}
+		report.Config = config
+	}
+
+	if entries, err := loadHistory(); err != nil {
+		fail("failed to load history: %v", err)
+	} else {
+		for _, e := range entries {
+			if e.JobID == jobID.String() {
+				report.History = e
+			}
+		}
+	}
+
+	return report
+}
+
+// jobType returns the type of the job in the report, or "" if unknown
+func (r *inspectReport) jobType() string {
+	var resp struct {
+		Data bsubio.Job `json:"data"`
+	}
+	if err := json.Unmarshal(r.Job, &resp); err != nil {
+		return ""
+	}
+	return derefString(resp.Data.Type)
+}
+
+// writeInspectBundle writes a .tar.gz holding the report and the job's logs,
+// plus its output if includeOutput is set. The bundle is written
+// atomically, so a failure never leaves a truncated archive behind.
+func writeInspectBundle(ctx context.Context, client *bsubio.BsubClient, report *inspectReport, jobID bsubio.JobId, path string, includeOutput bool) error {
+	prefix := fmt.Sprintf("bsubio-%s/", jobID)
+
+	type bundleFile struct {
+		name string
+		path string // file to copy, if data is nil
+		data []byte
+	}
+	var files []bundleFile
+
+	logs, err := readJobLogs(ctx, client, jobID)
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	} else {
+		files = append(files, bundleFile{name: "logs.txt", data: logs})
+	}
+
+	// Outputs can be large, so they are downloaded to a temporary file
+	if includeOutput {
+		tmpDir, err := os.MkdirTemp("", "bsubio-inspect-")
+		if err != nil {
+			return fmt.Errorf("failed to create temporary directory: %w", err)
+		}
+		defer func() {
+			_ = os.RemoveAll(tmpDir)
+		}()
+
+		name := "output." + outputExtension(ctx, client, report.jobType())
+		outPath := filepath.Join(tmpDir, name)
+		if err := downloadJobOutput(ctx, client, jobID, outPath, true); err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		} else {
+			files = append(files, bundleFile{name: name, path: outPath})
+		}
+	}
+
+	if len(report.Job) > 0 {
+		var job bytes.Buffer
+		if err := json.Indent(&job, report.Job, "", "  "); err == nil {
+			job.WriteByte('\n')
+			files = append(files, bundleFile{name: "job.json", data: job.Bytes()})
+		}
+	}
+
+	// report.json comes first in the archive, so it is what people see
+	// when they list it
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal report: %w", err)
+	}
+	files = append([]bundleFile{{name: "report.json", data: append(data, '\n')}}, files...)
+
+	err = writeFileAtomic(path, func(w io.Writer) error {
+		gz := gzip.NewWriter(w)
+		tw := tar.NewWriter(gz)
+
+		for _, f := range files {
+			if f.data != nil {
+				data := []byte(report.redact(string(f.data)))
+				if err := writeTarFile(tw, prefix+f.name, int64(len(data)), bytes.NewReader(data)); err != nil {
+					return err
+				}
+				continue
+			}
+
+			file, err := os.Open(f.path)
+			if err != nil {
+				return err
+			}
+			info, err := file.Stat()
+			if err == nil {
+				err = writeTarFile(tw, prefix+f.name, info.Size(), file)
+			}
+			_ = file.Close()
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := tw.Close(); err != nil {
+			return err
+		}
+		return gz.Close()
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+
+	return nil
+}
+
+// writeTarFile adds a regular file to a tar archive
+func writeTarFile(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tw, r)
+	return err
+}
+
+// readJobLogs returns the logs of a job
+func readJobLogs(ctx context.Context, client *bsubio.BsubClient, jobID bsubio.JobId) ([]byte, error) {
+	resp, err := client.GetJobLogs(ctx, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job logs: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != 200 {
+		return nil, httpErrorf(resp.StatusCode, "failed to get job logs")
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job logs: %w", err)
+	}
+
+	return data, nil
+}
+
+// redact removes the secrets of the report from text
+func (r *inspectReport) redact(s string) string {
+	for _, secret := range r.secrets {
+		s = redactAPIKey(s, secret)
+	}
+	return s
+}
+
+// redactJobSecrets replaces the values of secret fields in a job as the API
+// returned it, returning the redacted job and the secrets found
+func redactJobSecrets(raw []byte) (json.RawMessage, []string, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, nil, err
+	}
+
+	var secrets []string
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			for k, field := range v {
+				if s, ok := field.(string); ok && isSecretField(k) {
+					if s != "" {
+						secrets = append(secrets, s)
+						v[k] = redactedAPIKey
+					}
+					continue
+				}
+				walk(field)
+			}
+		case []any:
+			for _, item := range v {
+				walk(item)
+			}
+		}
+	}
+	walk(v)
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, secrets, nil
+}
+
+// isSecretField reports whether a JSON field name looks like it holds a
+// secret
+func isSecretField(name string) bool {
+	name = strings.ToLower(name)
+	for _, word := range secretFieldWords {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactAPIKey removes an API key from text, in case an error message or
+// the logs quote it. Keys too short to be told apart from ordinary text are
+// left alone; the config in the report is redacted regardless.
+func redactAPIKey(s, apiKey string) string {
+	if len(apiKey) < redactMinKeyLength {
+		return s
+	}
+	return strings.ReplaceAll(s, apiKey, redactedAPIKey)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bsubio/bsubio-go"
+	"github.com/google/uuid"
+)
+
+func TestRedactAPIKey(t *testing.T) {
+	tests := []struct {
+		s, key, want string
+	}{
+		{"auth failed for key sk-1234567890", "sk-1234567890", "auth failed for key REDACTED"},
+		{"nothing to hide", "sk-1234567890", "nothing to hide"},
+		{"a key too short to scrub", "key", "a key too short to scrub"},
+		{"no key configured", "", "no key configured"},
+	}
+
+	for _, tt := range tests {
+		if got := redactAPIKey(tt.s, tt.key); got != tt.want {
+			t.Errorf("redactAPIKey(%q, %q) = %q, want %q", tt.s, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestInspectBundleHasNoSecrets(t *testing.T) {
+	const (
+		apiKey      = "sk-test-api-key-1234"
+		uploadToken = "upload-token-5678"
+		nestedToken = "worker-secret-9012"
+	)
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	configDir := filepath.Join(home, ".config", "bsubio")
+	if err := os.MkdirAll(configDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	config := fmt.Sprintf(`{"api_key": %q, "base_url": "http://localhost"}`, apiKey)
+	if err := os.WriteFile(filepath.Join(configDir, "config.json"), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	jobID := uuid.New()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/logs"):
+			fmt.Fprintf(w, "uploading with %s\nworker %s\n", uploadToken, nestedToken)
+		case strings.HasSuffix(r.URL.Path, "/version"):
+			_, _ = io.WriteString(w, `{"version": "1.0.0"}`)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"success": true, "data": {"id": %q, "type": "passthru", "status": "failed",
+				"upload_token": %q, "worker": {"auth": {"client_secret": %q}},
+				"error_message": "request with key %s refused"}}`, jobID, uploadToken, nestedToken, apiKey)
+		}
+	}))
+	defer srv.Close()
+
+	client, err := bsubio.NewBsubClient(bsubio.Config{APIKey: apiKey, BaseURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	report := collectInspectReport(ctx, client, jobID)
+	path := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	if err := writeInspectBundle(ctx, client, report, jobID, path, false); err != nil {
+		t.Fatalf("writeInspectBundle: %v", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+
+	names := make(map[string]bool)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		name := strings.TrimPrefix(hdr.Name, "bsubio-"+jobID.String()+"/")
+		names[name] = true
+		for _, secret := range []string{apiKey, uploadToken, nestedToken} {
+			if strings.Contains(string(data), secret) {
+				t.Errorf("%s contains secret %q:\n%s", name, secret, data)
+			}
+		}
+	}
+
+	for _, name := range []string{"report.json", "job.json", "logs.txt"} {
+		if !names[name] {
+			t.Errorf("bundle has no %s", name)
+		}
+	}
+
+	var job struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal(report.Job, &job); err != nil {
+		t.Fatal(err)
+	}
+	if job.Data["upload_token"] != redactedAPIKey || job.Data["status"] != "failed" {
+		t.Errorf("job = %v, want upload_token redacted and other fields kept", job.Data)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bsubio/bsubio-go"
+)
+
+// The helpers in this file are shared by the commands that read input files
+// and save job outputs and logs to disk (apply, batch, fetch, inspect, pipe
+// and watch), so that they all name and write files the same way.
+
+// preferredExtensions overrides the system MIME table, which lists several
+// extensions for common types in no useful order (e.g., .asc for text/plain)
+var preferredExtensions = map[string]string{
+	"text/plain":       "txt",
+	"text/markdown":    "md",
+	"text/csv":         "csv",
+	"text/html":        "html",
+	"application/json": "json",
+	"application/pdf":  "pdf",
+	"application/xml":  "xml",
+	"application/zip":  "zip",
+	"image/jpeg":       "jpg",
+	"image/png":        "png",
+}
+
+// extensionForMIME returns a file extension, without the dot, for a MIME
+// type, or "" if none is known
+func extensionForMIME(mimeType string) string {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return ""
+	}
+
+	if ext, ok := preferredExtensions[mediaType]; ok {
+		return ext
+	}
+
+	exts, err := mime.ExtensionsByType(mediaType)
+	if err != nil || len(exts) == 0 {
+		return ""
+	}
+
+	return strings.TrimPrefix(exts[0], ".")
+}
+
+// typeExtension returns the file extension, without the dot, for the
+// outputs of a job type: the one it advertises, else one derived from the
+// first MIME type it produces, else "out"
+func typeExtension(types []bsubio.ProcessingType, jobType string) string {
+	t, ok := findType(types, jobType)
+	if !ok || t.Output == nil {
+		return "out"
+	}
+
+	if ext := strings.TrimPrefix(derefString(t.Output.Ext), "."); ext != "" {
+		return ext
+	}
+
+	if t.Output.MimeOut != nil && len(*t.Output.MimeOut) > 0 {
+		if ext := extensionForMIME((*t.Output.MimeOut)[0]); ext != "" {
+			return ext
+		}
+	}
+
+	return "out"
+}
+
+// outputExtension returns the file extension for the outputs of a job
+// type, looking the type up on the server
+func outputExtension(ctx context.Context, client *bsubio.BsubClient, jobType string) string {
+	types, err := fetchTypes(ctx, client)
+	if err != nil {
+		return "out"
+	}
+	return typeExtension(types, jobType)
+}
+
+// writeJobOutput downloads the output of a finished job into a file,
+// creating parent directories as needed
+func writeJobOutput(ctx context.Context, client *bsubio.BsubClient, jobID bsubio.JobId, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	return downloadJobOutput(ctx, client, jobID, path, false)
+}
+
+// writeJobLogs saves the logs of a job into a file
+func writeJobLogs(ctx context.Context, client *bsubio.BsubClient, jobID bsubio.JobId, path string) error {
+	data, err := readJobLogs(ctx, client, jobID)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create logs directory: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write logs file: %w", err)
+	}
+
+	return nil
+}
+
+// hashFile returns the hex encoded SHA-256 of a file's contents
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("input file not found: %s", path)
+		}
+		return "", fmt.Errorf("failed to access input file: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", fmt.Errorf("failed to read input file: %w", err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// resolvePath returns path as is if it is absolute, else joined to baseDir
+func resolvePath(baseDir, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(baseDir, path)
+}
+
+// fileExists reports whether path is an existing regular file
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/bsubio/bsubio-go"
+)
+
+func TestExtensionForMIME(t *testing.T) {
+	tests := []struct {
+		mimeType string
+		want     string
+	}{
+		{"text/plain", "txt"},
+		{"text/plain; charset=utf-8", "txt"},
+		{"TEXT/HTML", "html"},
+		{"application/json", "json"},
+		{"image/jpeg", "jpg"},
+		{"image/svg+xml", "svg"},
+		{"application/x-unknown-type", ""},
+		{"not a mime type", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := extensionForMIME(tt.mimeType); got != tt.want {
+			t.Errorf("extensionForMIME(%q) = %q, want %q", tt.mimeType, got, tt.want)
+		}
+	}
+}
+
+func TestTypeExtension(t *testing.T) {
+	var types []bsubio.ProcessingType
+	err := json.Unmarshal([]byte(`[
+		{"type": "pdf/extract", "output": {"ext": ".txt", "mime_out": ["application/json"]}},
+		{"type": "pdf/render", "output": {"mime_out": ["image/png", "image/jpeg"]}},
+		{"type": "bin/convert", "output": {"mime_out": ["application/x-unknown-type"]}},
+		{"type": "no/output"}
+	]`), &types)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		jobType string
+		want    string
+	}{
+		{"pdf/extract", "txt"},
+		{"pdf/render", "png"},
+		{"bin/convert", "out"},
+		{"no/output", "out"},
+		{"unknown/type", "out"},
+	}
+
+	for _, tt := range tests {
+		if got := typeExtension(types, tt.jobType); got != tt.want {
+			t.Errorf("typeExtension(%q) = %q, want %q", tt.jobType, got, tt.want)
+		}
+	}
+}
@@ -1,82 +1,154 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/bsubio/bsubio-go"
 )
 
+// jobsPageSize is the number of jobs first requested when jobs are filtered
+// locally, so that filters matching few jobs still fill the limit
+const jobsPageSize = 100
+
+// jobColumns are the CSV columns of jobs, named like the API's fields, plus
+// the computed queue and run times in seconds
+var jobColumns = []outputColumn[bsubio.Job]{
+	{"id", func(j bsubio.Job) string { return csvString(j.Id) }},
+	{"type", func(j bsubio.Job) string { return derefString(j.Type) }},
+	{"status", func(j bsubio.Job) string { return csvString(j.Status) }},
+	{"data_size", func(j bsubio.Job) string { return csvString(j.DataSize) }},
+	{"created_at", func(j bsubio.Job) string { return csvTime(j.CreatedAt) }},
+	{"claimed_at", func(j bsubio.Job) string { return csvTime(j.ClaimedAt) }},
+	{"finished_at", func(j bsubio.Job) string { return csvTime(j.FinishedAt) }},
+	{"claimed_by", func(j bsubio.Job) string { return derefString(j.ClaimedBy) }},
+	{"error_message", func(j bsubio.Job) string { return derefString(j.ErrorMessage) }},
+	{"queue_seconds", func(j bsubio.Job) string { return csvSeconds(jobQueueTime(j)) }},
+	{"run_seconds", func(j bsubio.Job) string { return csvSeconds(jobRunTime(j)) }},
+}
+
+// jobFilter selects jobs. Status is filtered by the server, everything
+// else locally.
+type jobFilter struct {
+	Status string
+	Type   string
+	Since  time.Time
+	Until  time.Time
+}
+
+// local reports whether the filter has conditions the server cannot apply
+func (f *jobFilter) local() bool {
+	return f.Type != "" || !f.Since.IsZero() || !f.Until.IsZero()
+}
+
+// match reports whether a job passes the local conditions of the filter
+func (f *jobFilter) match(job bsubio.Job) bool {
+	if f.Type != "" && derefString(job.Type) != f.Type {
+		return false
+	}
+	if !f.Since.IsZero() && (job.CreatedAt == nil || job.CreatedAt.Before(f.Since)) {
+		return false
+	}
+	if !f.Until.IsZero() && (job.CreatedAt == nil || !job.CreatedAt.Before(f.Until)) {
+		return false
+	}
+	return true
+}
+
 func runJobs(args []string) error {
-	var (
-		status string
-		limit  = 20 // default limit
-	)
+	fs := flag.NewFlagSet("jobs", flag.ContinueOnError)
+
+	// Define flags
+	status := fs.String("status", "", "Only list jobs with this status")
+	jobType := fs.String("type", "", "Only list jobs of this type")
+	since := fs.String("since", "", "Only list jobs created after this time (e.g., 2h, 7d, 2025-01-31)")
+	until := fs.String("until", "", "Only list jobs created before this time (e.g., 2h, 7d, 2025-01-31)")
+	limit := fs.Int("limit", 20, "Maximum number of jobs to list")
+	all := fs.Bool("all", false, "List every matching job, ignoring --limit")
+	sortBy := fs.String("sort", "created", "Sort by created, duration or size")
+	reverse := fs.Bool("reverse", false, "Reverse the sort order")
+	out := addOutputFlags(fs)
+
+	// Custom usage function
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bsubio jobs [options]\n\n")
+		fmt.Fprintf(fs.Output(), "List recent jobs\n\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+	}
 
 	// Parse flags
-	i := 0
-	for i < len(args) {
-		arg := args[i]
-		switch arg {
-		case "--status":
-			if i+1 >= len(args) {
-				return fmt.Errorf("--status flag requires a value")
-			}
-			status = args[i+1]
-			i += 2
-		case "--limit":
-			if i+1 >= len(args) {
-				return fmt.Errorf("--limit flag requires a value")
-			}
-			var err error
-			limit, err = strconv.Atoi(args[i+1])
-			if err != nil {
-				return fmt.Errorf("invalid limit value: %s", args[i+1])
-			}
-			i += 2
-		default:
-			return fmt.Errorf("unknown flag: %s", arg)
-		}
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
 	}
 
-	// Create client
-	client, err := createClient()
-	if err != nil {
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return usageErrorf("expected 0 arguments, got %d", fs.NArg())
+	}
+
+	if err := out.check(); err != nil {
 		return err
 	}
 
-	ctx := getContext()
+	if *limit < 1 && !*all {
+		return usageErrorf("limit must be at least 1")
+	}
 
-	// Build parameters
-	params := &bsubio.ListJobsParams{
-		Limit: &limit,
+	if !slices.Contains([]string{"created", "duration", "size"}, *sortBy) {
+		return usageErrorf("invalid sort key %q (expected created, duration or size)", *sortBy)
 	}
 
-	if status != "" {
-		statusParam := bsubio.ListJobsParamsStatus(status)
-		params.Status = &statusParam
+	filter := jobFilter{Status: *status, Type: *jobType}
+	now := time.Now()
+	var err error
+	if *since != "" {
+		if filter.Since, err = parseTimeArg(*since, now); err != nil {
+			return usageErrorf("invalid --since: %w", err)
+		}
+	}
+	if *until != "" {
+		if filter.Until, err = parseTimeArg(*until, now); err != nil {
+			return usageErrorf("invalid --until: %w", err)
+		}
 	}
 
-	// List jobs
-	resp, err := client.ListJobsWithResponse(ctx, params)
-	if err != nil {
-		return fmt.Errorf("failed to list jobs: %w", err)
+	if *all {
+		*limit = 0
 	}
 
-	if resp.StatusCode() != 200 {
-		return fmt.Errorf("failed to list jobs: HTTP %d", resp.StatusCode())
+	// Create client
+	client, err := createClient()
+	if err != nil {
+		return err
 	}
 
-	if resp.JSON200 == nil || resp.JSON200.Data == nil || resp.JSON200.Data.Jobs == nil {
-		return fmt.Errorf("unexpected response format")
+	ctx := getContext()
+
+	// An incomplete list is printed, then reported
+	jobs, listErr := listJobs(ctx, client, filter, *limit)
+	if listErr != nil && classifyError(listErr) != kindIncomplete {
+		return listErr
 	}
 
-	jobs := *resp.JSON200.Data.Jobs
+	sortJobs(jobs, *sortBy, *reverse)
+
+	if !out.table() {
+		if err := printList(out, jobs, jobColumns); err != nil {
+			return err
+		}
+		return listErr
+	}
 
 	// Display jobs
 	if len(jobs) == 0 {
 		fmt.Println("No jobs found")
-		return nil
+		return listErr
 	}
 
 	// Find the longest type string for proper alignment
@@ -88,7 +160,7 @@ func runJobs(args []string) error {
 	}
 
 	// Print header with dynamic TYPE column width
-	fmt.Printf("%-40s %-*s %-15s %s\n", "JOB ID", maxTypeLen, "TYPE", "STATUS", "CREATED AT")
+	fmt.Printf("%-40s %-*s %-15s %-16s %8s %8s %10s\n", "JOB ID", maxTypeLen, "TYPE", "STATUS", "CREATED AT", "QUEUED", "RUN", "SIZE")
 	fmt.Println("--------------------------------------------------------------------------------")
 
 	for _, job := range jobs {
@@ -112,8 +184,215 @@ func runJobs(args []string) error {
 			createdAt = job.CreatedAt.Format("2006-01-02 15:04")
 		}
 
-		fmt.Printf("%-40s %-*s %-15s %s\n", jobID, maxTypeLen, jobType, status, createdAt)
+		size := ""
+		if job.DataSize != nil {
+			size = formatBytes(*job.DataSize)
+		}
+
+		fmt.Printf("%-40s %-*s %-15s %-16s %8s %8s %10s\n", jobID, maxTypeLen, jobType, status, createdAt,
+			formatJobDuration(jobQueueTime(job)), formatJobDuration(jobRunTime(job)), size)
+	}
+
+	return listErr
+}
+
+// listJobs returns the most recent jobs matching filter, at most limit of
+// them, or all of them if limit is 0. The API has no offsets or cursors: it
+// returns the most recent jobs and their total count, so "pagination" here
+// means asking again with a bigger limit, until enough jobs match or there
+// are no more. When the server caps the limit, older jobs are out of reach:
+// the jobs listed so far are returned with an error of kind incomplete.
+func listJobs(ctx context.Context, client *bsubio.BsubClient, filter jobFilter, limit int) ([]bsubio.Job, error) {
+	size := limit
+	if limit == 0 || filter.local() {
+		size = max(limit, jobsPageSize)
+	}
+
+	for {
+		page, total, err := listJobsPage(ctx, client, filter.Status, size)
+		if err != nil {
+			return nil, err
+		}
+
+		var jobs []bsubio.Job
+		for _, job := range page {
+			if filter.match(job) {
+				jobs = append(jobs, job)
+			}
+		}
+
+		switch {
+		case limit > 0 && len(jobs) >= limit:
+			return jobs[:limit], nil
+		case len(page) >= total:
+			return jobs, nil
+		case len(page) < size:
+			return jobs, errorf(kindIncomplete, "the server returned only %d of %d jobs; older jobs cannot be listed", len(page), total)
+		case !filter.Since.IsZero() && len(page) > 0 && page[len(page)-1].CreatedAt != nil &&
+			page[len(page)-1].CreatedAt.Before(filter.Since):
+			// Jobs come newest first, so no older job can match
+			return jobs, nil
+		}
+
+		if limit == 0 {
+			size = total
+		} else {
+			size = min(size*2, total)
+		}
+	}
+}
+
+// listJobsPage returns the most recent jobs with the given status, and the
+// total number of such jobs
+func listJobsPage(ctx context.Context, client *bsubio.BsubClient, status string, limit int) ([]bsubio.Job, int, error) {
+	params := &bsubio.ListJobsParams{
+		Limit: &limit,
+	}
+
+	if status != "" {
+		statusParam := bsubio.ListJobsParamsStatus(status)
+		params.Status = &statusParam
+	}
+
+	resp, err := client.ListJobsWithResponse(ctx, params)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list jobs: %w", err)
+	}
+
+	if resp.StatusCode() != 200 {
+		return nil, 0, httpErrorf(resp.StatusCode(), "failed to list jobs")
+	}
+
+	if resp.JSON200 == nil || resp.JSON200.Data == nil || resp.JSON200.Data.Jobs == nil {
+		return nil, 0, fmt.Errorf("unexpected response format")
+	}
+
+	jobs := *resp.JSON200.Data.Jobs
+
+	total := len(jobs)
+	if resp.JSON200.Data.Total != nil {
+		total = max(*resp.JSON200.Data.Total, total)
+	}
+
+	return jobs, total, nil
+}
+
+// sortJobs sorts jobs newest first by creation time, or longest and
+// largest first by duration and size. Jobs missing the value sort last.
+func sortJobs(jobs []bsubio.Job, by string, reverse bool) {
+	key := func(j bsubio.Job) (float64, bool) {
+		switch by {
+		case "duration":
+			if d, ok := jobTotalTime(j); ok {
+				return d.Seconds(), true
+			}
+		case "size":
+			if j.DataSize != nil {
+				return float64(*j.DataSize), true
+			}
+		default:
+			if j.CreatedAt != nil {
+				return float64(j.CreatedAt.UnixNano()), true
+			}
+		}
+		return 0, false
+	}
+
+	slices.SortStableFunc(jobs, func(a, b bsubio.Job) int {
+		ka, okA := key(a)
+		kb, okB := key(b)
+		switch {
+		case okA != okB:
+			if okA {
+				return -1
+			}
+			return 1
+		case ka == kb:
+			return 0
+		case (ka > kb) != reverse:
+			return -1
+		default:
+			return 1
+		}
+	})
+}
+
+// jobQueueTime returns how long a job waited before a worker claimed it
+func jobQueueTime(j bsubio.Job) (time.Duration, bool) {
+	if j.CreatedAt == nil || j.ClaimedAt == nil {
+		return 0, false
+	}
+	return j.ClaimedAt.Sub(*j.CreatedAt), true
+}
+
+// jobRunTime returns how long a worker took to process a job
+func jobRunTime(j bsubio.Job) (time.Duration, bool) {
+	if j.ClaimedAt == nil || j.FinishedAt == nil {
+		return 0, false
+	}
+	return j.FinishedAt.Sub(*j.ClaimedAt), true
+}
+
+// jobTotalTime returns how long a job took from creation to completion
+func jobTotalTime(j bsubio.Job) (time.Duration, bool) {
+	if j.CreatedAt == nil || j.FinishedAt == nil {
+		return 0, false
+	}
+	return j.FinishedAt.Sub(*j.CreatedAt), true
+}
+
+// formatJobDuration formats an optional duration for tables
+func formatJobDuration(d time.Duration, ok bool) string {
+	if !ok {
+		return "-"
+	}
+	if d < 10*time.Second {
+		return d.Round(10 * time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
+
+// csvSeconds formats an optional duration in seconds for CSV output
+func csvSeconds(d time.Duration, ok bool) string {
+	if !ok {
+		return ""
+	}
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// parseTimeArg parses a point in time given either as a duration before
+// now (e.g., 90m, 2h, 7d) or as a date or time (RFC 3339, "2006-01-02" or
+// "2006-01-02 15:04", in local time)
+func parseTimeArg(s string, now time.Time) (time.Time, error) {
+	if d, err := parseAge(s); err == nil {
+		return now.Add(-d), nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("%q is neither a duration (e.g., 2h, 7d) nor a date (e.g., 2025-01-31)", s)
+}
+
+// parseAge parses a non-negative duration, which may also be given in days
+// (e.g., 7d or 1.5d)
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.ParseFloat(days, 64); err == nil && n >= 0 {
+			return time.Duration(n * float64(24*time.Hour)), nil
+		}
+	}
+
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return d, nil
 	}
 
-	return nil
+	return 0, fmt.Errorf("%q is not a duration (e.g., 90m, 2h, 7d)", s)
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bsubio/bsubio-go"
+)
+
+func TestParseTimeArg(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		arg  string
+		want time.Time
+	}{
+		{"2h", now.Add(-2 * time.Hour)},
+		{"90m", now.Add(-90 * time.Minute)},
+		{"7d", now.Add(-7 * 24 * time.Hour)},
+		{"1.5d", now.Add(-36 * time.Hour)},
+		{"2025-01-31T10:00:00Z", time.Date(2025, 1, 31, 10, 0, 0, 0, time.UTC)},
+		{"2025-01-31", time.Date(2025, 1, 31, 0, 0, 0, 0, time.Local)},
+		{"2025-01-31 14:30", time.Date(2025, 1, 31, 14, 30, 0, 0, time.Local)},
+	}
+
+	for _, tt := range tests {
+		got, err := parseTimeArg(tt.arg, now)
+		if err != nil {
+			t.Errorf("parseTimeArg(%q): %v", tt.arg, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseTimeArg(%q) = %v, want %v", tt.arg, got, tt.want)
+		}
+	}
+
+	for _, arg := range []string{"", "d", "-2h", "yesterday", "2025-13-01"} {
+		if _, err := parseTimeArg(arg, now); err == nil {
+			t.Errorf("parseTimeArg(%q) succeeded, want an error", arg)
+		}
+	}
+}
+
+func TestSortJobs(t *testing.T) {
+	base := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := base.Add(d)
+		return &t
+	}
+	size := func(n int64) *int64 { return &n }
+	name := func(s string) *string { return &s }
+
+	jobs := []bsubio.Job{
+		{Type: name("a"), CreatedAt: at(0), FinishedAt: at(time.Minute), DataSize: size(10)},
+		{Type: name("b"), CreatedAt: at(time.Hour)},
+		{Type: name("c"), CreatedAt: at(2 * time.Hour), FinishedAt: at(3 * time.Hour), DataSize: size(5)},
+	}
+
+	tests := []struct {
+		by      string
+		reverse bool
+		want    string
+	}{
+		{"created", false, "cba"},
+		{"created", true, "abc"},
+		{"duration", false, "cab"},
+		{"duration", true, "acb"},
+		{"size", false, "acb"},
+		{"size", true, "cab"},
+	}
+
+	for _, tt := range tests {
+		sorted := append([]bsubio.Job(nil), jobs...)
+		sortJobs(sorted, tt.by, tt.reverse)
+
+		got := ""
+		for _, j := range sorted {
+			got += *j.Type
+		}
+		if got != tt.want {
+			t.Errorf("sortJobs(%s, reverse=%v) = %s, want %s", tt.by, tt.reverse, got, tt.want)
+		}
+	}
+}
@@ -1,43 +1,58 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/google/uuid"
+	"github.com/bsubio/bsubio-go"
 )
 
+// logsMaxDelay caps the delay between two log fetches with -f, so that new
+// lines show up reasonably quickly even for long jobs
+const logsMaxDelay = 5 * time.Second
+
 func runLogs(args []string) error {
 	fs := flag.NewFlagSet("logs", flag.ContinueOnError)
 
+	// Define flags
+	follow := fs.Bool("f", false, "Follow the logs until the job completes")
+	fs.BoolVar(follow, "follow", false, "Same as -f")
+	tail := fs.Int("tail", -1, "Only show the last N lines, or all lines if negative")
+	timestamps := fs.Bool("timestamps", false, "Prefix each line with the time it was received")
+
 	// Custom usage function
 	fs.Usage = func() {
-		fmt.Fprintf(fs.Output(), "Usage: bsubio logs <jobid>\n\n")
+		fmt.Fprintf(fs.Output(), "Usage: bsubio logs [options] <jobid>\n\n")
 		fmt.Fprintf(fs.Output(), "Show job logs (stderr)\n\n")
-		fmt.Fprintf(fs.Output(), "Arguments:\n")
-		fmt.Fprintf(fs.Output(), "  jobid    Job ID\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "\nArguments:\n")
+		fmt.Fprintf(fs.Output(), "  jobid    Job ID, ID prefix, job name or @last[~N]\n")
 	}
 
-	// Parse flags (none defined, but this handles help/errors)
+	// Parse flags
 	if err := fs.Parse(args); err != nil {
-		return err
+		return usageError(err)
 	}
 
 	// Get remaining arguments
 	remainingArgs := fs.Args()
 	if len(remainingArgs) != 1 {
 		fs.Usage()
-		return fmt.Errorf("expected 1 argument, got %d", len(remainingArgs))
+		return usageErrorf("expected 1 argument, got %d", len(remainingArgs))
 	}
 
 	jobID := remainingArgs[0]
 
-	jobUUID, err := uuid.Parse(jobID)
-	if err != nil {
-		return fmt.Errorf("invalid job ID: %w", err)
-	}
-
 	// Create client
 	client, err := createClient()
 	if err != nil {
@@ -46,23 +61,230 @@ func runLogs(args []string) error {
 
 	ctx := getContext()
 
-	// Get job logs
-	resp, err := client.GetJobLogs(ctx, jobUUID)
+	jobUUID, err := resolveJobID(ctx, client, jobID)
+	if err != nil {
+		return err
+	}
+
+	out := &logWriter{w: os.Stdout, timestamps: *timestamps, now: time.Now}
+	follower := &logFollower{client: client, jobID: jobUUID}
+
+	if !*follow {
+		return follower.first(ctx, out, *tail)
+	}
+
+	return follower.follow(ctx, out, *tail)
+}
+
+// logFollower fetches the logs of a job incrementally, keeping track of how
+// many bytes were already written
+type logFollower struct {
+	client *bsubio.BsubClient
+	jobID  bsubio.JobId
+	offset int64
+}
+
+// first writes the logs fetched so far, or only their last tail lines if
+// tail is not negative
+func (f *logFollower) first(ctx context.Context, out io.Writer, tail int) error {
+	if tail < 0 {
+		_, err := f.fetch(ctx, out)
+		return err
+	}
+
+	var buf bytes.Buffer
+	if _, err := f.fetch(ctx, &buf); err != nil {
+		return err
+	}
+
+	if _, err := out.Write(lastLines(buf.Bytes(), tail)); err != nil {
+		return fmt.Errorf("failed to write logs: %w", err)
+	}
+	return nil
+}
+
+// follow writes the logs as they grow until the job completes. The job's
+// status is checked before each fetch, so once it is seen as completed, the
+// following fetch returns the complete log.
+func (f *logFollower) follow(ctx context.Context, out io.Writer, tail int) error {
+	backoff := newPollBackoff(pollClock, pollMinDelay, logsMaxDelay)
+	started := false
+
+	for {
+		job, err := getJob(ctx, f.client, f.jobID)
+		if err == nil {
+			var n int64
+			if !started {
+				err = f.first(ctx, out, tail)
+				started = err == nil
+			} else {
+				n, err = f.fetch(ctx, out)
+			}
+			if n > 0 {
+				backoff.Reset()
+			}
+		}
+
+		var throttled *throttledError
+		switch {
+		case errors.As(err, &throttled):
+			if err := pollSleep(ctx, backoff.Throttled(throttled.RetryAfter)); err != nil {
+				return err
+			}
+			continue
+		case err != nil:
+			return err
+		}
+
+		if job.Status != nil && (*job.Status == bsubio.JobStatusFinished || *job.Status == bsubio.JobStatusFailed) {
+			recordJobStatus(job)
+			return nil
+		}
+
+		if err := pollSleep(ctx, backoff.Next()); err != nil {
+			return err
+		}
+	}
+}
+
+// fetch writes the log bytes past the current offset and returns how many
+// there were. Servers supporting ranges answer with only the new bytes;
+// from the others the whole log is read and the known part skipped. When
+// the server streams the log, bytes are written as they arrive.
+func (f *logFollower) fetch(ctx context.Context, out io.Writer) (int64, error) {
+	offset := f.offset
+	resp, err := f.client.GetJobLogs(ctx, f.jobID, func(ctx context.Context, req *http.Request) error {
+		if offset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to get job logs: %w", err)
+		return 0, fmt.Errorf("failed to get job logs: %w", err)
 	}
 	defer func() {
 		_ = resp.Body.Close()
 	}()
 
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("failed to get job logs: HTTP %d", resp.StatusCode)
+	if err := checkThrottled(resp); err != nil {
+		return 0, err
 	}
 
-	// Write logs to stdout
-	if _, err := os.Stdout.ReadFrom(resp.Body); err != nil {
-		return fmt.Errorf("failed to write logs: %w", err)
+	skip := int64(0)
+	switch resp.StatusCode {
+	case http.StatusOK:
+		skip = offset
+	case http.StatusPartialContent:
+		start, ok := parseContentRangeStart(resp.Header.Get("Content-Range"))
+		if !ok || start > offset {
+			return 0, fmt.Errorf("failed to get job logs: unexpected Content-Range %q", resp.Header.Get("Content-Range"))
+		}
+		skip = offset - start
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Nothing was added since the last fetch
+		return 0, nil
+	default:
+		return 0, httpErrorf(resp.StatusCode, "failed to get job logs")
 	}
 
-	return nil
+	if skip > 0 {
+		if _, err := io.CopyN(io.Discard, resp.Body, skip); err != nil {
+			if errors.Is(err, io.EOF) {
+				return 0, nil
+			}
+			return 0, fmt.Errorf("failed to read job logs: %w", err)
+		}
+	}
+
+	n, err := io.Copy(out, resp.Body)
+	f.offset += n
+	if err != nil {
+		return n, fmt.Errorf("failed to write logs: %w", err)
+	}
+
+	return n, nil
+}
+
+// parseContentRangeStart returns the first byte position of a
+// "bytes <start>-<end>/<size>" Content-Range header
+func parseContentRangeStart(header string) (int64, bool) {
+	spec, ok := strings.CutPrefix(header, "bytes ")
+	if !ok {
+		return 0, false
+	}
+
+	start, _, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, false
+	}
+
+	n, err := strconv.ParseInt(start, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+
+	return n, true
+}
+
+// lastLines returns the last n lines of data. A final line without a
+// trailing newline counts as a line.
+func lastLines(data []byte, n int) []byte {
+	if n <= 0 {
+		return nil
+	}
+
+	end := len(data)
+	if end > 0 && data[end-1] == '\n' {
+		end--
+	}
+
+	for i := end - 1; i >= 0; i-- {
+		if data[i] == '\n' {
+			n--
+			if n == 0 {
+				return data[i+1:]
+			}
+		}
+	}
+
+	return data
+}
+
+// logWriter writes logs, optionally prefixing every line with the time it
+// was written
+type logWriter struct {
+	w          io.Writer
+	timestamps bool
+	now        func() time.Time
+	midLine    bool
+}
+
+func (lw *logWriter) Write(p []byte) (int, error) {
+	if !lw.timestamps {
+		return lw.w.Write(p)
+	}
+
+	var buf bytes.Buffer
+	for rest := p; len(rest) > 0; {
+		if !lw.midLine {
+			buf.WriteString(lw.now().Format(time.RFC3339))
+			buf.WriteByte(' ')
+		}
+
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			buf.Write(rest)
+			lw.midLine = true
+			break
+		}
+
+		buf.Write(rest[:i+1])
+		rest = rest[i+1:]
+		lw.midLine = false
+	}
+
+	if _, err := lw.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
 }
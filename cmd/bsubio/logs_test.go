@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bsubio/bsubio-go"
+	"github.com/google/uuid"
+)
+
+// fakeLogServer serves a growing job log, with or without Range support,
+// and a job that finishes once the whole log has been published
+type fakeLogServer struct {
+	mu      sync.Mutex
+	chunks  []string
+	visible int
+	ranges  bool
+	jobID   uuid.UUID
+	ranged  []string
+}
+
+func (s *fakeLogServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if strings.HasSuffix(r.URL.Path, "/logs") {
+		log := strings.Join(s.chunks[:s.visible], "")
+		rng := r.Header.Get("Range")
+		s.ranged = append(s.ranged, rng)
+
+		if !s.ranges || rng == "" {
+			_, _ = w.Write([]byte(log))
+			return
+		}
+
+		start, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"))
+		if start >= len(log) {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(log)-1, len(log)))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write([]byte(log[start:]))
+		return
+	}
+
+	// Every status poll publishes one more chunk of the log
+	status := bsubio.JobStatusProcessing
+	if s.visible < len(s.chunks) {
+		s.visible++
+	}
+	if s.visible == len(s.chunks) {
+		status = bsubio.JobStatusFinished
+	}
+	jobResponse(bsubio.Job{Id: &s.jobID, Status: &status})(w)
+}
+
+func followTestLogs(t *testing.T, ranges bool, tail int) (string, *fakeLogServer) {
+	useFakeClock(t)
+
+	fake := &fakeLogServer{
+		chunks: []string{"one\ntwo\n", "three\nfo", "ur\n", "five\n"},
+		ranges: ranges,
+		jobID:  uuid.New(),
+	}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	client, err := bsubio.NewBsubClient(bsubio.Config{APIKey: "test", BaseURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	follower := &logFollower{client: client, jobID: fake.jobID}
+	if err := follower.follow(context.Background(), &out, tail); err != nil {
+		t.Fatalf("follow: %v", err)
+	}
+
+	return out.String(), fake
+}
+
+func TestFollowLogsWithRange(t *testing.T) {
+	out, fake := followTestLogs(t, true, -1)
+
+	if want := "one\ntwo\nthree\nfour\nfive\n"; out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+	if want := []string{"", "bytes=8-", "bytes=16-", "bytes=19-"}; !slices.Equal(fake.ranged, want) {
+		t.Errorf("Range headers = %q, want %q", fake.ranged, want)
+	}
+}
+
+func TestFollowLogsWithoutRange(t *testing.T) {
+	out, _ := followTestLogs(t, false, -1)
+
+	if want := "one\ntwo\nthree\nfour\nfive\n"; out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+}
+
+func TestFollowLogsTail(t *testing.T) {
+	out, _ := followTestLogs(t, true, 1)
+
+	if want := "two\nthree\nfour\nfive\n"; out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+}
+
+func TestLastLines(t *testing.T) {
+	tests := []struct {
+		data string
+		n    int
+		want string
+	}{
+		{"a\nb\nc\n", 2, "b\nc\n"},
+		{"a\nb\nc", 2, "b\nc"},
+		{"a\nb\n", 5, "a\nb\n"},
+		{"a\nb\n", 0, ""},
+		{"", 3, ""},
+	}
+
+	for _, tt := range tests {
+		if got := string(lastLines([]byte(tt.data), tt.n)); got != tt.want {
+			t.Errorf("lastLines(%q, %d) = %q, want %q", tt.data, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestLogWriterTimestamps(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	lw := &logWriter{w: &buf, timestamps: true, now: func() time.Time { return now }}
+
+	for _, s := range []string{"one\ntw", "o\n", "three\n"} {
+		if _, err := lw.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ts := "2025-03-01T12:00:00Z "
+	if want := ts + "one\n" + ts + "two\n" + ts + "three\n"; buf.String() != want {
+		t.Errorf("output = %q, want %q", buf.String(), want)
+	}
+}
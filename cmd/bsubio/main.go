@@ -2,28 +2,64 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/bsubio/bsubio-go"
 )
 
 var version = "0.1.0"
 
+// errInterrupted is the cause of the command context being canceled by
+// Ctrl-C or SIGTERM
+var errInterrupted = errors.New("interrupted")
+
+// errTimedOut is the cause of the command context being canceled when the
+// --timeout deadline passes
+var errTimedOut = errors.New("timed out")
+
+// appCtx is canceled when the command is interrupted or times out
+var appCtx = context.Background()
+
+// jsonErrors makes errors be printed as JSON objects
+var jsonErrors bool
+
 func main() {
 	if err := run(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		os.Exit(reportError(err))
 	}
 }
 
 func run() error {
-	if len(os.Args) < 2 {
+	// Global options come before the command
+	global := flag.NewFlagSet("bsubio", flag.ContinueOnError)
+	timeout := global.Duration("timeout", 0, "Give up after this long (e.g., 30s, 10m)")
+	global.BoolVar(&jsonErrors, "json-errors", false, "Print errors as JSON objects on stderr")
+	global.SetOutput(io.Discard)
+
+	if err := global.Parse(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return runHelp(nil)
+		}
+		return usageErrorf("%v\nRun 'bsubio help' for usage", err)
+	}
+
+	if global.NArg() < 1 {
 		return runHelp(nil)
 	}
 
-	command := os.Args[1]
-	args := os.Args[2:]
+	var cancel context.CancelFunc
+	appCtx, cancel = newAppContext(*timeout)
+	defer cancel()
+
+	command := global.Arg(0)
+	args := global.Args()[1:]
 
 	switch command {
 	case "register":
@@ -32,32 +68,50 @@ func run() error {
 		return runConfig(args)
 	case "submit":
 		return runSubmit(args)
+	case "batch":
+		return runBatch(args)
+	case "apply":
+		return runApply(args)
+	case "pipe":
+		return runPipe(args)
+	case "watch":
+		return runWatch(args)
 	case "wait":
 		return runWait(args)
 	case "cat":
 		return runCat(args)
+	case "fetch":
+		return runFetch(args)
 	case "logs":
 		return runLogs(args)
 	case "jobs":
 		return runJobs(args)
+	case "history":
+		return runHistory(args)
 	case "status":
 		return runStatus(args)
+	case "inspect":
+		return runInspect(args)
 	case "cancel":
 		return runCancel(args)
 	case "rm":
 		return runRm(args)
+	case "gc":
+		return runGC(args)
 	case "version":
 		return runVersion(args)
 	case "types":
 		return runTypes(args)
 	case "bench":
 		return runBench(args)
+	case "cache":
+		return runCache(args)
 	case "quickstart":
 		return runQuickstart(args)
 	case "help", "-h", "--help":
 		return runHelpCommand(args)
 	default:
-		return fmt.Errorf("unknown command: %s\nRun 'bsubio help' for usage", command)
+		return usageErrorf("unknown command: %s\nRun 'bsubio help' for usage", command)
 	}
 }
 
@@ -65,25 +119,50 @@ func runHelp(args []string) error {
 	fmt.Print(`bsubio - Command line tool for bsub.io batch processing
 
 USAGE:
-    bsubio <command> [options] [arguments]
+    bsubio [global options] <command> [options] [arguments]
+
+GLOBAL OPTIONS:
+    --timeout <duration>        Give up after this long (e.g., 30s, 10m)
+    --json-errors               Print errors as JSON objects on stderr
 
 COMMANDS:
     register                    Register with bsub.io using GitHub
     config                      Configure API key manually
-    submit [-o <file>] [-w] <input_file> <type>
+    submit [-o <file>] [-w] [--job-name <name>] <type> <input_file>
                                 Submit a job for processing
-    wait [-v] [-t <seconds>] <jobid>
-                                Wait for a job to complete
-    cat <jobid>                 Print job output (stdout)
-    jobs [--status <status>] [--limit <n>]
+    batch [--concurrency <n>] [--out <dir>] [-r] <type> <file|dir|glob>...
+                                Submit many files and collect their outputs
+    apply [--force] <manifest>  Run the jobs listed in a YAML or JSON manifest
+    pipe [-o <file>] <input_file> <type1> [<type2> ...]
+                                Feed each job's output into the next job type
+    watch --type <type> [--out <dir>] <dir>
+                                Submit every file dropped into a directory
+    wait [-v] [-t <seconds>] [--all|--any] <jobid>...
+                                Wait for one or more jobs to complete
+    cat [-o <file>] <jobid>     Print job output (stdout) or save it to a file
+    jobs [--status <status>] [--type <type>] [--since <time>] [--all]
+         [--sort created|duration|size] [--output <format>]
                                 List recent jobs
-    status <jobid>              Show detailed job status
-    logs <jobid>                Show job logs (stderr)
-    cancel [-a|--all] <jobid>   Cancel a job (or all jobs with -a)
-    rm [-a|--all] <jobid>       Delete a job (or all jobs with -a)
+    history [--file <file>] [--type <type>] [--status <status>]
+                                Show jobs submitted from this machine
+    status [--watch] <jobid>... Show detailed job status
+    fetch [--out <dir>] [--mirror] [<jobid>...]
+                                Download outputs and logs of many jobs
+    logs [-f] [--tail <n>] <jobid>
+                                Show job logs (stderr)
+    inspect [--bundle] <jobid>  Collect job details for bug reports
+    cancel [--dry-run] [-a|<filters>|<jobid>...]
+                                Cancel jobs (all pending and running ones with -a)
+    rm [--dry-run] [-a|<filters>|<jobid>...]
+                                Delete jobs (all matching jobs with -a)
+    gc [--keep-last <n>] [--max-age <age>] [--dry-run]
+                                Delete old jobs according to retention rules
     version                     Show API server version
-    types                       List available job types
+    types [--accepts <mime>]    List available job types
+    types describe <type>       Show every field of a job type
+    types snapshot|diff         Save job types, or compare them with a snapshot
     bench [options]             Benchmark job processing with test files
+    cache ls|prune|clear        Manage the local result cache
     quickstart                  Show quickstart guide
     help [command]              Show help message or help for a specific command
 
@@ -91,19 +170,43 @@ EXAMPLES:
     bsubio register
     bsubio config
     bsubio submit pdf/extract simple.pdf
+    bsubio submit auto simple.pdf
     bsubio submit -w -o result.txt passthru input.txt
+    bsubio submit --job-name invoice-42 pdf/extract invoice.pdf
+    cat report.pdf | bsubio submit -w --mime application/pdf pdf/extract -
+    bsubio batch --concurrency 8 --out results pdf/extract scans/*.pdf
+    bsubio apply jobs.yaml
+    bsubio pipe -o summary.txt report.pdf pdf/extract text/summarize
+    bsubio watch --type pdf/extract --out results inbox/
     bsubio wait -v job_abc123
+    bsubio wait --any job_abc123 job_def456
     bsubio cat job_abc123
+    bsubio cat invoice-42
+    bsubio status @last
+    bsubio fetch --status finished --limit 200 --mirror --out results
     bsubio logs job_abc123
+    bsubio logs -f --tail 20 job_abc123
     bsubio status job_abc123
+    bsubio status --watch job_abc123 job_def456
+    bsubio inspect --bundle job_abc123
     bsubio cancel job_abc123
     bsubio cancel -a
     bsubio rm job_abc123
     bsubio rm -a
+    bsubio rm --status failed --older-than 30d --dry-run
+    bsubio gc --keep-last 500 --max-age 14d --keep-failed 30d --dry-run
     bsubio jobs --limit 10
+    bsubio jobs --since 24h --sort duration
+    bsubio jobs --status failed --template '{{.Id}}'
+    bsubio history --file report.pdf
     bsubio types
+    bsubio types --accepts application/pdf --json
+    bsubio types describe pdf/extract
+    bsubio types diff types.json
     bsubio bench
     bsubio bench --type pdf_extract --dir tests/data
+    bsubio cache ls
+    bsubio cache prune --max-size 500MB
     bsubio version
     bsubio quickstart
     bsubio help submit
@@ -129,7 +232,40 @@ func createClient() (*bsubio.BsubClient, error) {
 	return client, nil
 }
 
-// getContext returns a context for API calls
+// newAppContext returns the context commands run under. It is canceled by
+// the first Ctrl-C or SIGTERM, after which the default signal handling is
+// restored so a second Ctrl-C kills the process, and by the timeout if set.
+func newAppContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancelCause := context.WithCancelCause(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+			cancelCause(errInterrupted)
+		case <-ctx.Done():
+		}
+		signal.Stop(signals)
+	}()
+
+	cancel := func() {
+		cancelCause(context.Canceled)
+	}
+
+	if timeout > 0 {
+		timeoutCtx, cancelTimeout := context.WithTimeoutCause(ctx, timeout, fmt.Errorf("%w after %s", errTimedOut, timeout))
+		return timeoutCtx, func() {
+			cancelTimeout()
+			cancel()
+		}
+	}
+
+	return ctx, cancel
+}
+
+// getContext returns a context for API calls, canceled when the command is
+// interrupted or runs out of time
 func getContext() context.Context {
-	return context.Background()
+	return appCtx
 }
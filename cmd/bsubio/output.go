@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Listing commands print a table by default and take --output to print
+// JSON, JSON Lines, YAML or CSV instead, or --template to format every item
+// with a Go template. Field names in JSON, YAML and CSV are the API's (or,
+// for local data, the ones of the files the CLI stores), and templates see
+// the Go structs, e.g. {{.Id}} or {{.Status}} for jobs.
+
+// Output formats
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputJSONL = "jsonl"
+	outputYAML  = "yaml"
+	outputCSV   = "csv"
+)
+
+var outputFormats = []string{outputTable, outputJSON, outputJSONL, outputYAML, outputCSV}
+
+// outputOptions holds the --output and --template flags of a command
+type outputOptions struct {
+	Format   string
+	Template string
+
+	tmpl *template.Template
+}
+
+// addOutputFlags registers --output and --template on a command's flags
+func addOutputFlags(fs *flag.FlagSet) *outputOptions {
+	o := &outputOptions{}
+	fs.StringVar(&o.Format, "output", outputTable, "Output format: "+strings.Join(outputFormats, ", "))
+	fs.StringVar(&o.Template, "template", "", "Format each item with a Go template (e.g., '{{.Id}}')")
+	return o
+}
+
+// check validates the flags once they are parsed
+func (o *outputOptions) check() error {
+	valid := false
+	for _, f := range outputFormats {
+		if o.Format == f {
+			valid = true
+		}
+	}
+	if !valid {
+		return usageErrorf("invalid output format %q (expected one of: %s)", o.Format, strings.Join(outputFormats, ", "))
+	}
+
+	if o.Template == "" {
+		return nil
+	}
+
+	if o.Format != outputTable {
+		return usageErrorf("--template cannot be used with --output %s", o.Format)
+	}
+
+	tmpl, err := template.New("output").Parse(o.Template)
+	if err != nil {
+		return usageErrorf("invalid template: %w", err)
+	}
+	o.tmpl = tmpl
+
+	return nil
+}
+
+// table reports whether the command should print its own table
+func (o *outputOptions) table() bool {
+	return o.Format == outputTable && o.tmpl == nil
+}
+
+// outputColumn is a CSV column
+type outputColumn[T any] struct {
+	Name  string
+	Value func(item T) string
+}
+
+// printList prints items in the chosen format. Table output is left to the
+// command.
+func printList[T any](o *outputOptions, items []T, columns []outputColumn[T]) error {
+	return printItems(os.Stdout, o, items, columns, true)
+}
+
+// printItem prints a single item in the chosen format, as an object rather
+// than a list of one
+func printItem[T any](o *outputOptions, item T, columns []outputColumn[T]) error {
+	return printItems(os.Stdout, o, []T{item}, columns, false)
+}
+
+func printItems[T any](w io.Writer, o *outputOptions, items []T, columns []outputColumn[T], list bool) error {
+	if items == nil {
+		items = []T{}
+	}
+
+	switch {
+	case o.tmpl != nil:
+		for _, item := range items {
+			var buf bytes.Buffer
+			if err := o.tmpl.Execute(&buf, item); err != nil {
+				return fmt.Errorf("failed to execute template: %w", err)
+			}
+			if buf.Len() == 0 || buf.Bytes()[buf.Len()-1] != '\n' {
+				buf.WriteByte('\n')
+			}
+			if _, err := w.Write(buf.Bytes()); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case o.Format == outputJSON:
+		var v any = items
+		if !list {
+			v = items[0]
+		}
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal output: %w", err)
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+
+	case o.Format == outputJSONL:
+		for _, item := range items {
+			data, err := json.Marshal(item)
+			if err != nil {
+				return fmt.Errorf("failed to marshal output: %w", err)
+			}
+			if _, err := fmt.Fprintf(w, "%s\n", data); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case o.Format == outputYAML:
+		// Going through JSON gives YAML the same field names
+		var v any = items
+		if !list {
+			v = items[0]
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to marshal output: %w", err)
+		}
+		var generic any
+		if err := json.Unmarshal(data, &generic); err != nil {
+			return fmt.Errorf("failed to marshal output: %w", err)
+		}
+		data, err = yaml.Marshal(generic)
+		if err != nil {
+			return fmt.Errorf("failed to marshal output: %w", err)
+		}
+		_, err = w.Write(data)
+		return err
+
+	case o.Format == outputCSV:
+		cw := csv.NewWriter(w)
+		header := make([]string, len(columns))
+		for i, c := range columns {
+			header[i] = c.Name
+		}
+		if err := cw.Write(header); err != nil {
+			return err
+		}
+		for _, item := range items {
+			row := make([]string, len(columns))
+			for i, c := range columns {
+				row[i] = c.Value(item)
+			}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+
+	return fmt.Errorf("unsupported output format: %s", o.Format)
+}
+
+// csvTime formats an optional time for CSV output
+func csvTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// csvString formats an optional value for CSV output
+func csvString[T any](v *T) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(*v)
+}
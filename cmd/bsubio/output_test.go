@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+type testItem struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+var testColumns = []outputColumn[testItem]{
+	{"name", func(i testItem) string { return i.Name }},
+	{"count", func(i testItem) string { return csvString(&i.Count) }},
+}
+
+func TestPrintItems(t *testing.T) {
+	items := []testItem{{"a", 1}, {"b, c", 2}}
+
+	tests := []struct {
+		format   string
+		template string
+		list     bool
+		items    []testItem
+		want     string
+	}{
+		{outputJSON, "", true, items, "[\n  {\n    \"name\": \"a\",\n    \"count\": 1\n  },\n  {\n    \"name\": \"b, c\",\n    \"count\": 2\n  }\n]\n"},
+		{outputJSON, "", true, nil, "[]\n"},
+		{outputJSON, "", false, items[:1], "{\n  \"name\": \"a\",\n  \"count\": 1\n}\n"},
+		{outputJSONL, "", true, items, "{\"name\":\"a\",\"count\":1}\n{\"name\":\"b, c\",\"count\":2}\n"},
+		{outputYAML, "", true, items, "- count: 1\n  name: a\n- count: 2\n  name: b, c\n"},
+		{outputCSV, "", true, items, "name,count\na,1\n\"b, c\",2\n"},
+		{outputTable, "{{.Name}}={{.Count}}", true, items, "a=1\nb, c=2\n"},
+	}
+
+	for _, tt := range tests {
+		o := &outputOptions{Format: tt.format, Template: tt.template}
+		if err := o.check(); err != nil {
+			t.Fatalf("check(%q, %q): %v", tt.format, tt.template, err)
+		}
+
+		var buf bytes.Buffer
+		if err := printItems(&buf, o, tt.items, testColumns, tt.list); err != nil {
+			t.Fatalf("printItems(%q): %v", tt.format, err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("printItems(%q, %q) = %q, want %q", tt.format, tt.template, buf.String(), tt.want)
+		}
+	}
+}
+
+func TestOutputOptionsCheck(t *testing.T) {
+	tests := []struct {
+		format, template string
+		ok               bool
+	}{
+		{outputTable, "", true},
+		{outputCSV, "", true},
+		{"xml", "", false},
+		{outputJSON, "{{.Name}}", false},
+		{outputTable, "{{.Name", false},
+	}
+
+	for _, tt := range tests {
+		o := &outputOptions{Format: tt.format, Template: tt.template}
+		if err := o.check(); (err == nil) != tt.ok {
+			t.Errorf("check(%q, %q) = %v, want ok %v", tt.format, tt.template, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bsubio/bsubio-go"
+)
+
+// pipeStage records the job that ran one stage of a pipeline
+type pipeStage struct {
+	Type   string
+	JobID  string
+	Status string
+}
+
+func runPipe(args []string) error {
+	fs := flag.NewFlagSet("pipe", flag.ContinueOnError)
+
+	// Define flags
+	outputFile := fs.String("o", "", "Output file path (default: stdout)")
+
+	// Custom usage function
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bsubio pipe [options] <input_file> <type1> [<type2> ...]\n\n")
+		fmt.Fprintf(fs.Output(), "Run an input through a chain of job types, feeding each output into the next job\n\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "\nArguments:\n")
+		fmt.Fprintf(fs.Output(), "  input_file    Path to the input file, or - to read from stdin\n")
+		fmt.Fprintf(fs.Output(), "  type1...      Job types to run, in order\n")
+	}
+
+	// Parse flags
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	// Get remaining arguments
+	remainingArgs := fs.Args()
+	if len(remainingArgs) < 2 {
+		fs.Usage()
+		return usageErrorf("expected at least 2 arguments, got %d", len(remainingArgs))
+	}
+
+	inputFile := remainingArgs[0]
+	jobTypes := remainingArgs[1:]
+
+	// Open input (stdin or file)
+	var input io.Reader = os.Stdin
+	name := "stdin"
+	inputPath := ""
+	if inputFile != "-" {
+		file, err := os.Open(inputFile)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("input file not found: %s", inputFile)
+			}
+			return fmt.Errorf("failed to access input file: %w", err)
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+		input = file
+		name = filepath.Base(inputFile)
+		inputPath = inputFile
+	}
+	mimeType := mime.TypeByExtension(filepath.Ext(name))
+
+	// Create client
+	client, err := createClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := getContext()
+
+	stages := make([]pipeStage, 0, len(jobTypes))
+	defer func() {
+		printPipeStages(stages)
+	}()
+
+	var jobID bsubio.JobId
+	for i, jobType := range jobTypes {
+		stage := i + 1
+		fmt.Fprintf(os.Stderr, "Stage %d/%d (%s): submitting...\n", stage, len(jobTypes), jobType)
+
+		// Stages after the first read the previous stage's output
+		if i > 0 {
+			outputResp, err := client.GetJobOutput(ctx, jobID)
+			if err != nil {
+				return fmt.Errorf("stage %d: failed to get output of job %s: %w", i, jobID, err)
+			}
+			if outputResp.StatusCode != 200 {
+				_ = outputResp.Body.Close()
+				return httpErrorf(outputResp.StatusCode, "stage %d: failed to get output of job %s", i, jobID)
+			}
+
+			input = outputResp.Body
+			mimeType = ""
+			if mediaType, _, err := mime.ParseMediaType(outputResp.Header.Get("Content-Type")); err == nil {
+				mimeType = mediaType
+			}
+			name = pipeStageName(name, mimeType)
+			inputPath = ""
+
+			defer func() {
+				_ = outputResp.Body.Close()
+			}()
+		}
+
+		job, err := submitJob(ctx, client, jobType, input, name, mimeType, inputPath)
+		if err != nil {
+			return fmt.Errorf("stage %d (%s): failed to submit job: %w", stage, jobType, err)
+		}
+		jobID = *job.Id
+
+		stages = append(stages, pipeStage{Type: jobType, JobID: jobID.String(), Status: "submitted"})
+		fmt.Fprintf(os.Stderr, "Stage %d/%d (%s): job %s\n", stage, len(jobTypes), jobType, jobID)
+
+		finishedJob, err := waitForJob(ctx, client, jobID)
+		if err != nil {
+			return fmt.Errorf("stage %d (%s): failed to wait for job: %w", stage, jobType, err)
+		}
+		recordJobStatus(finishedJob)
+
+		if finishedJob.Status != nil {
+			stages[i].Status = string(*finishedJob.Status)
+		}
+
+		if finishedJob.Status != nil && *finishedJob.Status == bsubio.JobStatusFailed {
+			printPipeStageLogs(ctx, client, jobID)
+			return &cliError{
+				Kind:  kindJobFailed,
+				JobID: jobID.String(),
+				Err:   fmt.Errorf("stage %d (%s) %w", stage, jobType, jobFailedError(jobID, finishedJob.ErrorMessage)),
+			}
+		}
+	}
+
+	// Write the output of the last stage
+	if *outputFile != "" {
+		if err := writeJobOutput(ctx, client, jobID, *outputFile); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Output saved to %s\n", *outputFile)
+		return nil
+	}
+
+	outputResp, err := client.GetJobOutput(ctx, jobID)
+	if err != nil {
+		return fmt.Errorf("failed to get job output: %w", err)
+	}
+	defer func() {
+		_ = outputResp.Body.Close()
+	}()
+
+	if outputResp.StatusCode != 200 {
+		return httpErrorf(outputResp.StatusCode, "failed to get job output")
+	}
+
+	if _, err := os.Stdout.ReadFrom(outputResp.Body); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+
+	return nil
+}
+
+// pipeStageName derives the file name sent with an intermediate output,
+// swapping the extension for one matching its MIME type when known
+func pipeStageName(name, mimeType string) string {
+	ext := extensionForMIME(mimeType)
+	if ext == "" {
+		return name
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name)) + "." + ext
+}
+
+// printPipeStageLogs prints the logs of a failed stage to stderr
+func printPipeStageLogs(ctx context.Context, client *bsubio.BsubClient, jobID bsubio.JobId) {
+	resp, err := client.GetJobLogs(ctx, jobID)
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != 200 {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "--- logs of job %s ---\n", jobID)
+	_, _ = io.Copy(os.Stderr, resp.Body)
+	fmt.Fprintf(os.Stderr, "--- end of logs ---\n")
+}
+
+// printPipeStages prints the job ID of every stage that was started
+func printPipeStages(stages []pipeStage) {
+	if len(stages) == 0 {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "\n%-6s %-20s %-36s %s\n", "STAGE", "TYPE", "JOB ID", "STATUS")
+	for i, s := range stages {
+		fmt.Fprintf(os.Stderr, "%-6d %-20s %-36s %s\n", i+1, s.Type, s.JobID, s.Status)
+	}
+}
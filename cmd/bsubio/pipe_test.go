@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestPipeStageName(t *testing.T) {
+	tests := []struct {
+		name, mimeType, want string
+	}{
+		{"scan.pdf", "text/plain; charset=utf-8", "scan.txt"},
+		{"scan.pdf", "image/jpeg", "scan.jpg"},
+		{"page.txt", "text/html", "page.html"},
+		{"data", "application/json", "data.json"},
+		{"scan.pdf", "application/x-unknown-type", "scan.pdf"},
+		{"scan.pdf", "", "scan.pdf"},
+	}
+
+	for _, tt := range tests {
+		if got := pipeStageName(tt.name, tt.mimeType); got != tt.want {
+			t.Errorf("pipeStageName(%q, %q) = %q, want %q", tt.name, tt.mimeType, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bsubio/bsubio-go"
+)
+
+// Every command waiting for jobs polls through the engine in this file. It
+// starts polling quickly, backs off exponentially with jitter, sleeps until
+// shortly before a job is expected to finish when past jobs of the same
+// type tell how long that usually takes, and honours 429/503 responses and
+// their Retry-After header.
+
+const (
+	// pollMinDelay is the delay before the first poll and after a reset
+	pollMinDelay = 500 * time.Millisecond
+
+	// pollMaxDelay caps the delay between two polls
+	pollMaxDelay = 30 * time.Second
+
+	// pollJitter is the fraction by which each delay is randomly varied
+	pollJitter = 0.2
+
+	// pollHistorySize is how many durations are kept per job type
+	pollHistorySize = 20
+)
+
+// clock abstracts time so the polling engine can be tested with a fake clock
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// pollClock is the clock used by the polling engine
+var pollClock clock = realClock{}
+
+// pollBackoff computes the delays between polls
+type pollBackoff struct {
+	clock  clock
+	rand   func() float64
+	min    time.Duration
+	max    time.Duration
+	delay  time.Duration
+	expect time.Time
+}
+
+// newPollBackoff creates a backoff starting at min and growing up to max
+func newPollBackoff(c clock, min, max time.Duration) *pollBackoff {
+	return &pollBackoff{
+		clock: c,
+		rand:  rand.Float64,
+		min:   min,
+		max:   max,
+		delay: min,
+	}
+}
+
+// Expect tells the backoff when the job is likely to finish. Until then it
+// polls rarely; once that time has passed it starts again from the minimum
+// delay. Only the earliest expected time is kept.
+func (b *pollBackoff) Expect(t time.Time) {
+	if b.expect.IsZero() || t.Before(b.expect) {
+		b.expect = t
+	}
+}
+
+// Next returns how long to wait before the next poll
+func (b *pollBackoff) Next() time.Duration {
+	if !b.expect.IsZero() {
+		remaining := b.expect.Sub(b.clock.Now())
+		if remaining > b.min {
+			return b.clamp(b.jitter(remaining))
+		}
+		// The job is due, so poll quickly again
+		b.expect = time.Time{}
+		b.delay = b.min
+	}
+
+	d := b.delay
+	b.delay = min(b.delay*2, b.max)
+	return b.clamp(b.jitter(d))
+}
+
+// Reset starts the backoff again from the minimum delay, e.g. after the
+// job made visible progress
+func (b *pollBackoff) Reset() {
+	b.delay = b.min
+}
+
+// Throttled returns how long to wait after the server asked the client to
+// slow down. A Retry-After delay is honoured as is; without one, the
+// backoff is doubled.
+func (b *pollBackoff) Throttled(retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		b.delay = min(max(b.delay, retryAfter), b.max)
+		return retryAfter
+	}
+
+	b.delay = min(b.delay*2, b.max)
+	return b.Next()
+}
+
+func (b *pollBackoff) jitter(d time.Duration) time.Duration {
+	return time.Duration(float64(d) * (1 - pollJitter + 2*pollJitter*b.rand()))
+}
+
+func (b *pollBackoff) clamp(d time.Duration) time.Duration {
+	return min(max(d, b.min), b.max)
+}
+
+// throttledError is returned when the server answers 429 or 503
+type throttledError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *throttledError) Error() string {
+	return fmt.Sprintf("server is throttling requests: HTTP %d", e.StatusCode)
+}
+
+// checkThrottled returns a throttledError for 429 and 503 responses
+func checkThrottled(resp *http.Response) error {
+	if resp == nil || (resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable) {
+		return nil
+	}
+
+	return &throttledError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), pollClock.Now()),
+	}
+}
+
+// parseRetryAfter parses a Retry-After header, given either in seconds or
+// as an HTTP date. It returns 0 if the header is missing or invalid.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+
+	if secs, err := strconv.Atoi(header); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+
+	if t, err := http.ParseTime(header); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+
+	return 0
+}
+
+// pollSleep waits for d on the poll clock, returning early if ctx is done
+func pollSleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-pollClock.After(d):
+		return nil
+	}
+}
+
+// waitForJob polls a job until it finishes or fails. It replaces the SDK's
+// WaitForJob, which polls at a fixed interval and ignores throttling.
+func waitForJob(ctx context.Context, client *bsubio.BsubClient, jobID bsubio.JobId) (*bsubio.Job, error) {
+	return pollJob(ctx, client, jobID, newPollBackoff(pollClock, pollMinDelay, pollMaxDelay))
+}
+
+// pollJob polls a job until it finishes or fails, waiting between polls as
+// told by backoff. A backoff whose minimum and maximum are equal polls at a
+// fixed interval.
+func pollJob(ctx context.Context, client *bsubio.BsubClient, jobID bsubio.JobId, backoff *pollBackoff) (*bsubio.Job, error) {
+	expected := false
+
+	for {
+		job, err := getJob(ctx, client, jobID)
+
+		var throttled *throttledError
+		switch {
+		case errors.As(err, &throttled):
+			if err := pollSleep(ctx, backoff.Throttled(throttled.RetryAfter)); err != nil {
+				return nil, err
+			}
+			continue
+		case err != nil:
+			return nil, err
+		}
+
+		if job.Status != nil && (*job.Status == bsubio.JobStatusFinished || *job.Status == bsubio.JobStatusFailed) {
+			recordJobDuration(job)
+			return job, nil
+		}
+
+		if !expected {
+			expected = true
+			if t, ok := expectedFinish(job); ok {
+				backoff.Expect(t)
+			}
+		}
+
+		if err := pollSleep(ctx, backoff.Next()); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// jobDurations keeps the most recent processing durations of each job type,
+// in seconds, so that waits can be timed to when jobs usually finish
+type jobDurations struct {
+	Types map[string][]float64 `json:"types"`
+}
+
+var durationsMu sync.Mutex
+
+func getDurationsPath() (string, error) {
+	cacheDir, err := getCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "durations.json"), nil
+}
+
+func loadJobDurations() *jobDurations {
+	durations := &jobDurations{Types: make(map[string][]float64)}
+
+	path, err := getDurationsPath()
+	if err != nil {
+		return durations
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return durations
+	}
+
+	// A corrupt file only means waits are not adapted until it is rewritten
+	if err := json.Unmarshal(data, durations); err != nil || durations.Types == nil {
+		durations.Types = make(map[string][]float64)
+	}
+
+	return durations
+}
+
+// typicalDuration returns the median of the recorded durations of a job type
+func typicalDuration(jobType string) (time.Duration, bool) {
+	durationsMu.Lock()
+	defer durationsMu.Unlock()
+
+	samples := slices.Clone(loadJobDurations().Types[jobType])
+	if len(samples) == 0 {
+		return 0, false
+	}
+
+	slices.Sort(samples)
+	median := samples[len(samples)/2]
+	if len(samples)%2 == 0 {
+		median = (samples[len(samples)/2-1] + median) / 2
+	}
+
+	return time.Duration(median * float64(time.Second)), true
+}
+
+// expectedFinish returns when a job is expected to finish, based on the
+// typical duration of its type
+func expectedFinish(job *bsubio.Job) (time.Time, bool) {
+	if job.Type == nil || job.CreatedAt == nil {
+		return time.Time{}, false
+	}
+
+	typical, ok := typicalDuration(*job.Type)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return job.CreatedAt.Add(typical), true
+}
+
+// recordJobDuration remembers how long a finished job took from creation
+// to completion. Failed jobs are ignored, since they often fail early.
+func recordJobDuration(job *bsubio.Job) {
+	if job.Type == nil || job.Status == nil || *job.Status != bsubio.JobStatusFinished ||
+		job.CreatedAt == nil || job.FinishedAt == nil {
+		return
+	}
+
+	took := job.FinishedAt.Sub(*job.CreatedAt)
+	if took <= 0 {
+		return
+	}
+
+	durationsMu.Lock()
+	defer durationsMu.Unlock()
+
+	durations := loadJobDurations()
+	samples := append(durations.Types[*job.Type], took.Seconds())
+	if len(samples) > pollHistorySize {
+		samples = samples[len(samples)-pollHistorySize:]
+	}
+	durations.Types[*job.Type] = samples
+
+	path, err := getDurationsPath()
+	if err != nil {
+		return
+	}
+
+	data, err := json.Marshal(durations)
+	if err != nil {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	_ = os.WriteFile(path, data, 0644)
+}
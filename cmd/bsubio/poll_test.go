@@ -0,0 +1,411 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bsubio/bsubio-go"
+	"github.com/google/uuid"
+)
+
+// fakeClock is a clock whose time only moves when something waits on it
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	c.sleeps = append(c.sleeps, d)
+
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func (c *fakeClock) Sleeps() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]time.Duration(nil), c.sleeps...)
+}
+
+// useFakeClock installs a fake clock for the polling engine and points the
+// cache directory, which holds the job durations, to a temporary directory
+func useFakeClock(t *testing.T) *fakeClock {
+	t.Helper()
+
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	c := newFakeClock()
+	prev := pollClock
+	pollClock = c
+	t.Cleanup(func() { pollClock = prev })
+
+	return c
+}
+
+// newTestBackoff returns a backoff without jitter
+func newTestBackoff(c clock) *pollBackoff {
+	b := newPollBackoff(c, time.Second, 16*time.Second)
+	b.rand = func() float64 { return 0.5 }
+	return b
+}
+
+func TestPollBackoffGrowsExponentially(t *testing.T) {
+	b := newTestBackoff(newFakeClock())
+
+	want := []time.Duration{1, 2, 4, 8, 16, 16, 16}
+	for i, w := range want {
+		if got := b.Next(); got != w*time.Second {
+			t.Errorf("delay %d = %s, want %s", i, got, w*time.Second)
+		}
+	}
+}
+
+func TestPollBackoffJitter(t *testing.T) {
+	for _, r := range []float64{0, 0.25, 0.75, 0.999} {
+		b := newPollBackoff(newFakeClock(), time.Second, time.Minute)
+		b.rand = func() float64 { return r }
+
+		b.Next()
+		got := b.Next()
+		low := time.Duration(float64(2*time.Second) * (1 - pollJitter))
+		high := time.Duration(float64(2*time.Second) * (1 + pollJitter))
+		if got < low || got > high {
+			t.Errorf("rand %.3f: delay %s outside [%s, %s]", r, got, low, high)
+		}
+	}
+
+	// Jitter never takes a delay outside the bounds
+	b := newPollBackoff(newFakeClock(), time.Second, 4*time.Second)
+	b.rand = func() float64 { return 0 }
+	if got := b.Next(); got != time.Second {
+		t.Errorf("first delay = %s, want the 1s minimum", got)
+	}
+	b.rand = func() float64 { return 0.999 }
+	for range 5 {
+		b.Next()
+	}
+	if got := b.Next(); got != 4*time.Second {
+		t.Errorf("delay = %s, want the 4s maximum", got)
+	}
+}
+
+func TestPollBackoffExpect(t *testing.T) {
+	c := newFakeClock()
+	b := newTestBackoff(c)
+
+	// Jobs usually take 10s: sleep until then, then poll fast again
+	b.Expect(c.Now().Add(10 * time.Second))
+
+	if got := b.Next(); got != 10*time.Second {
+		t.Fatalf("first delay = %s, want 10s", got)
+	}
+	c.After(10 * time.Second)
+
+	want := []time.Duration{1, 2, 4}
+	for i, w := range want {
+		if got := b.Next(); got != w*time.Second {
+			t.Errorf("delay %d after the expected time = %s, want %s", i, got, w*time.Second)
+		}
+	}
+}
+
+func TestPollBackoffExpectCappedAtMax(t *testing.T) {
+	c := newFakeClock()
+	b := newTestBackoff(c)
+
+	b.Expect(c.Now().Add(time.Hour))
+	if got := b.Next(); got != 16*time.Second {
+		t.Errorf("delay = %s, want the 16s maximum", got)
+	}
+}
+
+func TestPollBackoffFixedInterval(t *testing.T) {
+	c := newFakeClock()
+	b := newPollBackoff(c, 5*time.Second, 5*time.Second)
+	b.rand = func() float64 { return 0.999 }
+
+	b.Expect(c.Now().Add(time.Minute))
+	for i := range 4 {
+		if got := b.Next(); got != 5*time.Second {
+			t.Errorf("delay %d = %s, want the fixed 5s", i, got)
+		}
+	}
+	b.Throttled(0)
+	if got := b.Next(); got != 5*time.Second {
+		t.Errorf("delay after throttling = %s, want the fixed 5s", got)
+	}
+}
+
+func TestPollBackoffThrottled(t *testing.T) {
+	b := newTestBackoff(newFakeClock())
+
+	// Retry-After is honoured exactly, even above the maximum
+	if got := b.Throttled(40 * time.Second); got != 40*time.Second {
+		t.Errorf("throttled delay = %s, want 40s", got)
+	}
+
+	// Later polls do not go back below the throttled delay
+	if got := b.Next(); got != 16*time.Second {
+		t.Errorf("delay after throttling = %s, want 16s", got)
+	}
+
+	// Without Retry-After the backoff doubles
+	b = newTestBackoff(newFakeClock())
+	b.Next()
+	if got := b.Throttled(0); got != 4*time.Second {
+		t.Errorf("throttled delay without Retry-After = %s, want 4s", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", 0},
+		{"7", 7 * time.Second},
+		{"0", 0},
+		{"-3", 0},
+		{"soon", 0},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.header, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestTypicalDuration(t *testing.T) {
+	useFakeClock(t)
+
+	if _, ok := typicalDuration("pdf/extract"); ok {
+		t.Fatal("typical duration known before any job finished")
+	}
+
+	created := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, secs := range []int{30, 10, 20, 1000} {
+		finished := created.Add(time.Duration(secs) * time.Second)
+		recordJobDuration(&bsubio.Job{
+			Type:       ptr("pdf/extract"),
+			Status:     ptr(bsubio.JobStatusFinished),
+			CreatedAt:  &created,
+			FinishedAt: &finished,
+		})
+	}
+
+	// Failed jobs are not taken into account
+	failedAt := created.Add(time.Second)
+	recordJobDuration(&bsubio.Job{
+		Type:       ptr("pdf/extract"),
+		Status:     ptr(bsubio.JobStatusFailed),
+		CreatedAt:  &created,
+		FinishedAt: &failedAt,
+	})
+
+	got, ok := typicalDuration("pdf/extract")
+	if !ok || got != 25*time.Second {
+		t.Errorf("typicalDuration = %s, %v, want 25s (median)", got, ok)
+	}
+
+	for range pollHistorySize {
+		finished := created.Add(5 * time.Second)
+		recordJobDuration(&bsubio.Job{
+			Type:       ptr("pdf/extract"),
+			Status:     ptr(bsubio.JobStatusFinished),
+			CreatedAt:  &created,
+			FinishedAt: &finished,
+		})
+	}
+
+	if got, _ := typicalDuration("pdf/extract"); got != 5*time.Second {
+		t.Errorf("typicalDuration = %s after old samples expired, want 5s", got)
+	}
+}
+
+// fakeJobServer answers GetJob with a scripted sequence of responses
+type fakeJobServer struct {
+	mu        sync.Mutex
+	responses []func(w http.ResponseWriter)
+	calls     int
+}
+
+func (s *fakeJobServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !strings.HasPrefix(r.URL.Path, "/v1/jobs/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	i := min(s.calls, len(s.responses)-1)
+	s.calls++
+	s.responses[i](w)
+}
+
+func jobResponse(job bsubio.Job) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"success": true, "data": job})
+	}
+}
+
+func throttledResponse(retryAfter string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+	}
+}
+
+func TestWaitForJobHonoursRetryAfter(t *testing.T) {
+	c := useFakeClock(t)
+
+	id := uuid.New()
+	created := c.Now()
+	finished := created.Add(3 * time.Second)
+	running := bsubio.Job{Id: &id, Type: ptr("passthru"), Status: ptr(bsubio.JobStatusProcessing), CreatedAt: &created}
+	done := bsubio.Job{Id: &id, Type: ptr("passthru"), Status: ptr(bsubio.JobStatusFinished), CreatedAt: &created, FinishedAt: &finished}
+
+	fake := &fakeJobServer{responses: []func(http.ResponseWriter){
+		jobResponse(running),
+		throttledResponse("7"),
+		jobResponse(running),
+		jobResponse(done),
+	}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	client, err := bsubio.NewBsubClient(bsubio.Config{APIKey: "test", BaseURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := waitForJob(context.Background(), client, id)
+	if err != nil {
+		t.Fatalf("waitForJob: %v", err)
+	}
+	if *job.Status != bsubio.JobStatusFinished {
+		t.Errorf("status = %s, want finished", *job.Status)
+	}
+
+	sleeps := c.Sleeps()
+	if len(sleeps) != 3 {
+		t.Fatalf("slept %d times (%v), want 3", len(sleeps), sleeps)
+	}
+	if sleeps[1] != 7*time.Second {
+		t.Errorf("sleep after 429 = %s, want the 7s from Retry-After", sleeps[1])
+	}
+	for i, d := range sleeps {
+		if d < pollMinDelay {
+			t.Errorf("sleep %d = %s, below the %s minimum", i, d, pollMinDelay)
+		}
+	}
+
+	// The duration of the finished job is remembered for the next waits
+	if got, ok := typicalDuration("passthru"); !ok || got != 3*time.Second {
+		t.Errorf("typicalDuration = %s, %v, want 3s", got, ok)
+	}
+}
+
+func TestWaitForJobSleepsUntilTypicalDuration(t *testing.T) {
+	c := useFakeClock(t)
+
+	id := uuid.New()
+	created := c.Now()
+	before := created.Add(-time.Minute)
+	typicalEnd := before.Add(20 * time.Second)
+	recordJobDuration(&bsubio.Job{
+		Type:       ptr("slow"),
+		Status:     ptr(bsubio.JobStatusFinished),
+		CreatedAt:  &before,
+		FinishedAt: &typicalEnd,
+	})
+
+	finished := created.Add(20 * time.Second)
+	running := bsubio.Job{Id: &id, Type: ptr("slow"), Status: ptr(bsubio.JobStatusProcessing), CreatedAt: &created}
+	done := bsubio.Job{Id: &id, Type: ptr("slow"), Status: ptr(bsubio.JobStatusFinished), CreatedAt: &created, FinishedAt: &finished}
+
+	fake := &fakeJobServer{responses: []func(http.ResponseWriter){
+		jobResponse(running),
+		jobResponse(done),
+	}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	client, err := bsubio.NewBsubClient(bsubio.Config{APIKey: "test", BaseURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := waitForJob(context.Background(), client, id); err != nil {
+		t.Fatalf("waitForJob: %v", err)
+	}
+
+	// Instead of many short polls, the first sleep lasts about as long as
+	// jobs of this type usually take
+	sleeps := c.Sleeps()
+	if len(sleeps) != 1 {
+		t.Fatalf("slept %d times (%v), want 1", len(sleeps), sleeps)
+	}
+	low := time.Duration(float64(20*time.Second) * (1 - pollJitter))
+	if sleeps[0] < low {
+		t.Errorf("first sleep = %s, want about 20s", sleeps[0])
+	}
+}
+
+func TestWaitForJobStopsWhenCanceled(t *testing.T) {
+	useFakeClock(t)
+
+	id := uuid.New()
+	running := bsubio.Job{Id: &id, Status: ptr(bsubio.JobStatusPending)}
+
+	fake := &fakeJobServer{responses: []func(http.ResponseWriter){jobResponse(running)}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	client, err := bsubio.NewBsubClient(bsubio.Config{APIKey: "test", BaseURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := waitForJob(ctx, client, id); err == nil {
+		t.Fatal("waitForJob returned without error after the context was canceled")
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
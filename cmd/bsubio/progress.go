@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// progressBar draws transfer progress on stderr. It does nothing unless
+// stderr is a terminal, so it is safe to use when output is redirected.
+type progressBar struct {
+	label   string
+	total   int64
+	enabled bool
+	w       io.Writer
+
+	mu       sync.Mutex
+	current  int64
+	lastDraw time.Time
+}
+
+// newProgressBar creates a progress bar; total may be 0 if unknown
+func newProgressBar(label string, total int64) *progressBar {
+	return &progressBar{
+		label:   label,
+		total:   total,
+		enabled: term.IsTerminal(int(os.Stderr.Fd())),
+		w:       os.Stderr,
+	}
+}
+
+// Add advances the progress bar by n bytes
+func (p *progressBar) Add(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.current += n
+	p.drawLocked(false)
+}
+
+// Set moves the progress bar to n bytes
+func (p *progressBar) Set(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.current = n
+	p.drawLocked(false)
+}
+
+// SetTotal changes the total size; it may be 0 or negative if unknown
+func (p *progressBar) SetTotal(total int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.total = total
+}
+
+// Finish draws the final state and ends the line
+func (p *progressBar) Finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.enabled {
+		return
+	}
+
+	p.drawLocked(true)
+	fmt.Fprintln(p.w)
+	p.enabled = false
+}
+
+func (p *progressBar) drawLocked(force bool) {
+	if !p.enabled {
+		return
+	}
+
+	now := time.Now()
+	if !force && now.Sub(p.lastDraw) < 100*time.Millisecond {
+		return
+	}
+	p.lastDraw = now
+
+	if p.total <= 0 {
+		fmt.Fprintf(p.w, "\r%s %s", p.label, formatBytes(p.current))
+		return
+	}
+
+	const width = 30
+	ratio := float64(p.current) / float64(p.total)
+	if ratio > 1 {
+		ratio = 1
+	}
+	filled := int(ratio * width)
+
+	fmt.Fprintf(p.w, "\r%s [%s%s] %3.0f%% %s/%s",
+		p.label,
+		strings.Repeat("=", filled),
+		strings.Repeat(" ", width-filled),
+		ratio*100,
+		formatBytes(p.current),
+		formatBytes(p.total))
+}
+
+// progressReader advances a progress bar as data is read through it
+type progressReader struct {
+	r   io.Reader
+	bar *progressBar
+}
+
+func (pr *progressReader) Read(b []byte) (int, error) {
+	n, err := pr.r.Read(b)
+	pr.bar.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestProgressReader(t *testing.T) {
+	var out bytes.Buffer
+	bar := &progressBar{label: "Uploading", total: 2048, enabled: true, w: &out}
+
+	data, err := io.ReadAll(&progressReader{r: strings.NewReader(strings.Repeat("x", 1024)), bar: bar})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 1024 || bar.current != 1024 {
+		t.Errorf("read %d bytes, bar at %d, want 1024 for both", len(data), bar.current)
+	}
+
+	bar.Finish()
+	if got := out.String(); !strings.HasSuffix(got, " 50% 1.0KB/2.0KB\n") {
+		t.Errorf("final line = %q, want it to end at 50%% of 2.0KB", got)
+	}
+
+	// Finishing twice draws nothing more
+	out.Reset()
+	bar.Finish()
+	if out.Len() != 0 {
+		t.Errorf("second Finish wrote %q", out.String())
+	}
+}
+
+func TestProgressBarUnknownTotal(t *testing.T) {
+	var out bytes.Buffer
+	bar := &progressBar{label: "Uploading", enabled: true, w: &out}
+
+	bar.Add(3000)
+	bar.Finish()
+	if got := out.String(); !strings.HasSuffix(got, "\rUploading 2.9KB\n") {
+		t.Errorf("output = %q, want the byte count only", got)
+	}
+}
+
+func TestProgressBarDisabled(t *testing.T) {
+	var out bytes.Buffer
+	bar := &progressBar{label: "Uploading", total: 10, w: &out}
+
+	bar.Add(5)
+	bar.Finish()
+	if out.Len() != 0 {
+		t.Errorf("disabled bar wrote %q", out.String())
+	}
+}
@@ -39,7 +39,7 @@ func runRegister(args []string) error {
 
 	// Parse flags
 	if err := fs.Parse(args); err != nil {
-		return err
+		return usageError(err)
 	}
 
 	// Get hostname
@@ -107,10 +107,13 @@ func runRegister(args []string) error {
 	fmt.Fprintln(os.Stderr, "✓ Authentication complete.")
 
 	// Step 4: Save configuration
-	config := &Config{
-		APIKey:  apiKey,
-		BaseURL: baseURL,
+	config, err := loadConfig()
+	if err != nil {
+		// Start from scratch if there is no usable config yet
+		config = &Config{}
 	}
+	config.APIKey = apiKey
+	config.BaseURL = baseURL
 
 	if err := saveConfig(config); err != nil {
 		return fmt.Errorf("failed to save configuration: %w", err)
@@ -197,7 +200,7 @@ func requestDeviceCode(baseURL, hostname string, debug bool) (deviceCode, userCo
 
 	client := newHTTPClient()
 
-	req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(getContext(), "POST", endpoint, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return "", "", "", 0, 0, err
 	}
@@ -271,7 +274,7 @@ func pollForAuthorization(baseURL, deviceCode, userCode string, interval, expire
 			fmt.Fprintf(os.Stderr, "\nPOST %s\n", endpoint)
 		}
 
-		req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(jsonData))
+		req, err := http.NewRequestWithContext(getContext(), "POST", endpoint, bytes.NewBuffer(jsonData))
 		if err != nil {
 			return "", nil, err
 		}
@@ -355,7 +358,11 @@ func pollForAuthorization(baseURL, deviceCode, userCode string, interval, expire
 		}
 
 		// Wait before next poll
-		time.Sleep(pollInterval)
+		select {
+		case <-getContext().Done():
+			return "", nil, getContext().Err()
+		case <-time.After(pollInterval):
+		}
 	}
 }
 
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bsubio/bsubio-go"
+	"github.com/google/uuid"
+)
+
+// Commands that take job IDs also accept:
+//
+//   - a name given with submit --job-name, looked up in the local history
+//   - @last, the job last submitted from this machine, or @last~N, the one
+//     N submissions before it
+//   - a unique prefix of a job ID, matched against the local history and
+//     the most recent jobs of the account
+//
+// Names are tried before prefixes, so a name that looks like hex wins.
+
+// resolveMinPrefix is the shortest job ID prefix accepted, so that a
+// mistyped argument is not taken for a prefix
+const resolveMinPrefix = 4
+
+// resolveRecentJobs is the number of recent jobs prefixes are matched
+// against, besides the local history
+const resolveRecentJobs = 1000
+
+var (
+	lastJobPattern   = regexp.MustCompile(`^@last(?:~(\d+))?$`)
+	jobPrefixPattern = regexp.MustCompile(`^[0-9a-fA-F-]+$`)
+)
+
+// jobResolver turns job arguments into job IDs. The history and the recent
+// jobs are loaded on first use and shared by all the arguments of a command.
+type jobResolver struct {
+	client *bsubio.BsubClient
+
+	history       []*historyEntry
+	historyLoaded bool
+	recent        []bsubio.Job
+	recentLoaded  bool
+}
+
+func newJobResolver(client *bsubio.BsubClient) *jobResolver {
+	return &jobResolver{client: client}
+}
+
+// resolve returns the job ID an argument refers to
+func (r *jobResolver) resolve(ctx context.Context, arg string) (bsubio.JobId, error) {
+	if id, err := uuid.Parse(arg); err == nil {
+		return id, nil
+	}
+
+	if m := lastJobPattern.FindStringSubmatch(arg); m != nil {
+		return r.resolveLast(m[1])
+	}
+
+	if strings.HasPrefix(arg, "@") {
+		return uuid.Nil, usageErrorf("invalid job reference %q (expected @last or @last~N)", arg)
+	}
+
+	history, err := r.loadHistory()
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	// The job last given a name wins, so reusing a name moves it
+	var named *historyEntry
+	for _, e := range history {
+		if e.Name == arg && (named == nil || e.nameLine > named.nameLine) {
+			named = e
+		}
+	}
+	if named != nil {
+		return r.parseHistoryID(named)
+	}
+
+	if !jobPrefixPattern.MatchString(arg) {
+		return uuid.Nil, errorf(kindNotFound, "no job named %q in the local history", arg)
+	}
+	if len(arg) < resolveMinPrefix {
+		return uuid.Nil, usageErrorf("job ID prefix %q is too short (at least %d characters)", arg, resolveMinPrefix)
+	}
+
+	return r.resolvePrefix(ctx, strings.ToLower(arg))
+}
+
+// resolveLast returns the job submitted back submissions before the last one
+func (r *jobResolver) resolveLast(back string) (bsubio.JobId, error) {
+	n := 0
+	if back != "" {
+		var err error
+		if n, err = strconv.Atoi(back); err != nil {
+			return uuid.Nil, usageErrorf("invalid job reference @last~%s", back)
+		}
+	}
+
+	history, err := r.loadHistory()
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	// Only submissions count, not jobs merely named, e.g. on a cache hit
+	history = slices.DeleteFunc(slices.Clone(history), func(e *historyEntry) bool {
+		return e.SubmittedAt.IsZero()
+	})
+
+	if n >= len(history) {
+		if len(history) == 0 {
+			return uuid.Nil, errorf(kindNotFound, "no jobs in the local history")
+		}
+		return uuid.Nil, errorf(kindNotFound, "only %d job(s) in the local history", len(history))
+	}
+
+	return r.parseHistoryID(history[len(history)-1-n])
+}
+
+// resolvePrefix returns the only job whose ID starts with prefix
+func (r *jobResolver) resolvePrefix(ctx context.Context, prefix string) (bsubio.JobId, error) {
+	var matches []bsubio.JobId
+	add := func(id bsubio.JobId) {
+		if strings.HasPrefix(id.String(), prefix) && !slices.Contains(matches, id) {
+			matches = append(matches, id)
+		}
+	}
+
+	for _, e := range r.history {
+		if id, err := uuid.Parse(e.JobID); err == nil {
+			add(id)
+		}
+	}
+
+	recent, err := r.loadRecent(ctx)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	for _, job := range recent {
+		if job.Id != nil {
+			add(*job.Id)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return uuid.Nil, errorf(kindNotFound, "no recent job matches %q", prefix)
+	case 1:
+		return matches[0], nil
+	}
+
+	ids := make([]string, 0, len(matches))
+	for _, id := range matches {
+		ids = append(ids, id.String())
+	}
+	slices.Sort(ids)
+	return uuid.Nil, usageErrorf("job ID prefix %q is ambiguous, it matches:\n  %s", prefix, strings.Join(ids, "\n  "))
+}
+
+func (r *jobResolver) parseHistoryID(e *historyEntry) (bsubio.JobId, error) {
+	id, err := uuid.Parse(e.JobID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid job ID %q in the local history: %w", e.JobID, err)
+	}
+	return id, nil
+}
+
+func (r *jobResolver) loadHistory() ([]*historyEntry, error) {
+	if !r.historyLoaded {
+		history, err := loadHistory()
+		if err != nil {
+			return nil, err
+		}
+		r.history = history
+		r.historyLoaded = true
+	}
+	return r.history, nil
+}
+
+func (r *jobResolver) loadRecent(ctx context.Context) ([]bsubio.Job, error) {
+	if !r.recentLoaded {
+		recent, _, err := listJobsPage(ctx, r.client, "", resolveRecentJobs)
+		if err != nil {
+			return nil, err
+		}
+		r.recent = recent
+		r.recentLoaded = true
+	}
+	return r.recent, nil
+}
+
+// resolveJobID returns the job ID a single argument refers to
+func resolveJobID(ctx context.Context, client *bsubio.BsubClient, arg string) (bsubio.JobId, error) {
+	return newJobResolver(client).resolve(ctx, arg)
+}
+
+// resolveJobIDs returns the job IDs arguments refer to, without duplicates
+func resolveJobIDs(ctx context.Context, client *bsubio.BsubClient, args []string) ([]bsubio.JobId, error) {
+	r := newJobResolver(client)
+
+	var ids []bsubio.JobId
+	for _, arg := range args {
+		id, err := r.resolve(ctx, arg)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+// validJobName reports why a name cannot be given to a job, if it cannot
+func validJobName(name string) error {
+	switch {
+	case strings.TrimSpace(name) != name || name == "":
+		return fmt.Errorf("job name %q must not be empty or start or end with spaces", name)
+	case strings.HasPrefix(name, "@"):
+		return fmt.Errorf("job name %q must not start with @", name)
+	case strings.ContainsAny(name, "\n\r\t"):
+		return fmt.Errorf("job name %q must not contain control characters", name)
+	}
+	if _, err := uuid.Parse(name); err == nil {
+		return fmt.Errorf("job name %q must not be a job ID", name)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bsubio/bsubio-go"
+	"github.com/google/uuid"
+)
+
+func TestJobResolver(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	ids := []string{
+		"aaaa1111-0000-4000-8000-000000000001",
+		"aaaa2222-0000-4000-8000-000000000002",
+		"bbbb1111-0000-4000-8000-000000000003",
+	}
+	start := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	for i, id := range ids {
+		appendHistory(historyEntry{JobID: id, SubmittedAt: start.Add(time.Duration(i) * time.Minute)})
+	}
+	recordJobName(ids[0], "invoice-42")
+	recordJobName(ids[1], "beef")
+	recordJobName(ids[2], "invoice-42")
+
+	// Recent jobs would come from the API
+	recentID := uuid.MustParse("cccc1111-0000-4000-8000-000000000004")
+	r := newJobResolver(nil)
+	r.recent = []bsubio.Job{{Id: &recentID}}
+	r.recentLoaded = true
+
+	tests := []struct {
+		arg  string
+		want string
+	}{
+		{ids[1], ids[1]},
+		{"@last", ids[2]},
+		{"@last~2", ids[0]},
+		{"invoice-42", ids[2]},
+		{"beef", ids[1]},
+		{"BBBB", ids[2]},
+		{"aaaa2", ids[1]},
+		{"cccc", recentID.String()},
+	}
+
+	for _, tt := range tests {
+		got, err := r.resolve(context.Background(), tt.arg)
+		if err != nil {
+			t.Errorf("resolve(%q): %v", tt.arg, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("resolve(%q) = %s, want %s", tt.arg, got, tt.want)
+		}
+	}
+
+	errorTests := []struct {
+		arg  string
+		kind errorKind
+	}{
+		{"aaaa", kindUsage}, // ambiguous
+		{"aaa", kindUsage},  // too short
+		{"@first", kindUsage},
+		{"@last~3", kindNotFound},
+		{"dddd", kindNotFound},
+		{"unknown-name", kindNotFound},
+	}
+
+	for _, tt := range errorTests {
+		_, err := r.resolve(context.Background(), tt.arg)
+		if err == nil {
+			t.Errorf("resolve(%q) succeeded, want a %s error", tt.arg, tt.kind)
+			continue
+		}
+		if kind := classifyError(err); kind != tt.kind {
+			t.Errorf("resolve(%q) error kind = %s, want %s (%v)", tt.arg, kind, tt.kind, err)
+		}
+	}
+}
+
+func TestJobResolverCacheHitName(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	older := "aaaa1111-0000-4000-8000-000000000001"
+	newer := "bbbb1111-0000-4000-8000-000000000002"
+	unknown := "cccc1111-0000-4000-8000-000000000003"
+	start := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	appendHistory(historyEntry{JobID: older, SubmittedAt: start})
+	recordJobName(older, "report")
+	appendHistory(historyEntry{JobID: newer, SubmittedAt: start.Add(time.Minute)})
+	recordJobName(newer, "report")
+
+	// Cache hits name jobs without submitting them, including jobs whose
+	// submission is missing from the history
+	recordJobName(older, "report")
+	recordJobName(unknown, "cached")
+
+	r := newJobResolver(nil)
+	tests := []struct {
+		arg  string
+		want string
+	}{
+		{"@last", newer},
+		{"@last~1", older},
+		{"report", older},
+		{"cached", unknown},
+	}
+
+	for _, tt := range tests {
+		got, err := r.resolve(context.Background(), tt.arg)
+		if err != nil {
+			t.Errorf("resolve(%q): %v", tt.arg, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("resolve(%q) = %s, want %s", tt.arg, got, tt.want)
+		}
+	}
+
+	if _, err := r.resolve(context.Background(), "@last~2"); classifyError(err) != kindNotFound {
+		t.Errorf("resolve(@last~2) error = %v, want a not_found error", err)
+	}
+}
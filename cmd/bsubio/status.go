@@ -1,40 +1,53 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
 
-	"github.com/google/uuid"
+	"github.com/bsubio/bsubio-go"
+	"golang.org/x/term"
 )
 
+// statusTimelineWidth is the number of characters of the timeline bar
+const statusTimelineWidth = 40
+
 func runStatus(args []string) error {
 	fs := flag.NewFlagSet("status", flag.ContinueOnError)
 
+	// Define flags
+	watch := fs.Bool("watch", false, "Show the status again whenever a job changes state, until all jobs finish or fail")
+	out := addOutputFlags(fs)
+
 	// Custom usage function
 	fs.Usage = func() {
-		fmt.Fprintf(fs.Output(), "Usage: bsubio status <jobid>\n\n")
+		fmt.Fprintf(fs.Output(), "Usage: bsubio status [options] <jobid>...\n\n")
 		fmt.Fprintf(fs.Output(), "Show detailed job status\n\n")
-		fmt.Fprintf(fs.Output(), "Arguments:\n")
-		fmt.Fprintf(fs.Output(), "  jobid    Job ID\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "\nArguments:\n")
+		fmt.Fprintf(fs.Output(), "  jobid    Job IDs, ID prefixes, job names or @last[~N]\n")
 	}
 
-	// Parse flags (none defined, but this handles help/errors)
+	// Parse flags
 	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	if err := out.check(); err != nil {
 		return err
 	}
 
 	// Get remaining arguments
 	remainingArgs := fs.Args()
-	if len(remainingArgs) != 1 {
+	if len(remainingArgs) == 0 {
 		fs.Usage()
-		return fmt.Errorf("expected 1 argument, got %d", len(remainingArgs))
-	}
-
-	jobID := remainingArgs[0]
-
-	jobUUID, err := uuid.Parse(jobID)
-	if err != nil {
-		return fmt.Errorf("invalid job ID: %w", err)
+		return usageErrorf("expected at least 1 argument, got 0")
 	}
 
 	// Create client
@@ -45,58 +58,255 @@ func runStatus(args []string) error {
 
 	ctx := getContext()
 
-	// Get job details
-	resp, err := client.GetJobWithResponse(ctx, jobUUID)
+	jobIDs, err := resolveJobIDs(ctx, client, remainingArgs)
 	if err != nil {
-		return fmt.Errorf("failed to get job status: %w", err)
+		return err
+	}
+
+	if !*watch {
+		jobs, err := getJobs(ctx, client, jobIDs)
+		if err != nil {
+			return err
+		}
+		return printJobStatus(os.Stdout, out, jobs, time.Now())
+	}
+
+	return watchJobStatus(ctx, client, out, jobIDs)
+}
+
+// getJobs fetches several jobs, in order
+func getJobs(ctx context.Context, client *bsubio.BsubClient, jobIDs []bsubio.JobId) ([]*bsubio.Job, error) {
+	jobs := make([]*bsubio.Job, 0, len(jobIDs))
+	for _, id := range jobIDs {
+		job, err := getJob(ctx, client, id)
+		if err != nil {
+			return nil, err
+		}
+		recordJobStatus(job)
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// watchJobStatus prints the status of the jobs, then again whenever one of
+// them changes state, until they have all finished or failed. On a
+// terminal the screen is cleared before each update.
+func watchJobStatus(ctx context.Context, client *bsubio.BsubClient, out *outputOptions, jobIDs []bsubio.JobId) error {
+	live := out.table() && term.IsTerminal(int(os.Stdout.Fd()))
+	backoff := newPollBackoff(pollClock, pollMinDelay, pollMaxDelay)
+
+	last := ""
+	for {
+		jobs, err := getJobs(ctx, client, jobIDs)
+
+		var throttled *throttledError
+		if errors.As(err, &throttled) {
+			if err := pollSleep(ctx, backoff.Throttled(throttled.RetryAfter)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		states := make([]string, len(jobs))
+		done := true
+		for i, job := range jobs {
+			states[i] = string(derefStatus(job.Status))
+			if !jobDone(job) {
+				done = false
+			}
+		}
+
+		if state := strings.Join(states, ","); state != last {
+			if live {
+				fmt.Print("\033[H\033[2J")
+			} else if last != "" && out.table() {
+				fmt.Println()
+			}
+			if err := printJobStatus(os.Stdout, out, jobs, time.Now()); err != nil {
+				return err
+			}
+			last = state
+			backoff.Reset()
+		}
+
+		if done {
+			return nil
+		}
+
+		if err := pollSleep(ctx, backoff.Next()); err != nil {
+			return err
+		}
 	}
+}
 
-	if resp.StatusCode() != 200 {
-		return fmt.Errorf("failed to get job status: HTTP %d", resp.StatusCode())
+// printJobStatus prints the status of jobs, as of now. A single job is
+// printed as an object by the structured formats, several as a list.
+func printJobStatus(w io.Writer, out *outputOptions, jobs []*bsubio.Job, now time.Time) error {
+	if !out.table() {
+		items := make([]bsubio.Job, len(jobs))
+		for i, job := range jobs {
+			items[i] = *job
+		}
+		return printItems(w, out, items, jobColumns, len(items) != 1)
 	}
 
-	if resp.JSON200 == nil || resp.JSON200.Data == nil {
-		return fmt.Errorf("unexpected response format")
+	for i, job := range jobs {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		writeJobDetails(w, job, now)
 	}
 
-	job := resp.JSON200.Data
+	return nil
+}
 
-	// Display job details
+// writeJobDetails prints the fields of a job, the time it spent in each
+// state and a timeline of its lifecycle
+func writeJobDetails(w io.Writer, job *bsubio.Job, now time.Time) {
 	if job.Id != nil {
-		fmt.Printf("ID:          %s\n", *job.Id)
+		fmt.Fprintf(w, "ID:          %s\n", *job.Id)
 	}
 
 	if job.Type != nil {
-		fmt.Printf("Type:        %s\n", *job.Type)
+		fmt.Fprintf(w, "Type:        %s\n", *job.Type)
 	}
 
 	if job.Status != nil {
-		fmt.Printf("Status:      %s\n", *job.Status)
+		fmt.Fprintf(w, "Status:      %s\n", *job.Status)
 	}
 
 	if job.DataSize != nil {
-		fmt.Printf("Data Size:   %d bytes\n", *job.DataSize)
+		fmt.Fprintf(w, "Data Size:   %d bytes\n", *job.DataSize)
 	}
 
 	if job.CreatedAt != nil {
-		fmt.Printf("Created At:  %s\n", job.CreatedAt.Format("2006-01-02 15:04:05"))
+		fmt.Fprintf(w, "Created At:  %s\n", job.CreatedAt.Format("2006-01-02 15:04:05"))
 	}
 
 	if job.ClaimedAt != nil {
-		fmt.Printf("Claimed At:  %s\n", job.ClaimedAt.Format("2006-01-02 15:04:05"))
+		fmt.Fprintf(w, "Claimed At:  %s\n", job.ClaimedAt.Format("2006-01-02 15:04:05"))
 	}
 
 	if job.FinishedAt != nil {
-		fmt.Printf("Finished At: %s\n", job.FinishedAt.Format("2006-01-02 15:04:05"))
+		fmt.Fprintf(w, "Finished At: %s\n", job.FinishedAt.Format("2006-01-02 15:04:05"))
 	}
 
 	if job.ClaimedBy != nil {
-		fmt.Printf("Claimed By:  %s\n", *job.ClaimedBy)
+		fmt.Fprintf(w, "Claimed By:  %s\n", *job.ClaimedBy)
+	}
+
+	// Jobs still queued or running are measured up to now
+	if job.CreatedAt != nil {
+		if d, ok := jobQueueTime(*job); ok {
+			fmt.Fprintf(w, "Queue Time:  %s\n", formatJobDuration(d, true))
+		} else if !jobDone(job) {
+			fmt.Fprintf(w, "Queue Time:  %s (waiting)\n", formatJobDuration(now.Sub(*job.CreatedAt), true))
+		}
+	}
+
+	if d, ok := jobRunTime(*job); ok {
+		fmt.Fprintf(w, "Run Time:    %s\n", formatJobDuration(d, true))
+		if job.DataSize != nil && d > 0 {
+			rate := float64(*job.DataSize) / d.Seconds()
+			fmt.Fprintf(w, "Throughput:  %s/s\n", formatBytes(int64(rate)))
+		}
+	} else if job.ClaimedAt != nil && !jobDone(job) {
+		fmt.Fprintf(w, "Run Time:    %s (running)\n", formatJobDuration(now.Sub(*job.ClaimedAt), true))
+	}
+
+	if job.CreatedAt != nil {
+		fmt.Fprintf(w, "Age:         %s\n", formatJobDuration(now.Sub(*job.CreatedAt), true))
+		if timeline := jobTimeline(job, now, statusTimelineWidth); timeline != "" {
+			fmt.Fprintf(w, "Timeline:    %s\n", timeline)
+		}
 	}
 
 	if job.ErrorMessage != nil && *job.ErrorMessage != "" {
-		fmt.Printf("\nError:       %s\n", *job.ErrorMessage)
+		fmt.Fprintf(w, "\nError:       %s\n", *job.ErrorMessage)
 	}
+}
 
-	return nil
+// jobTimeline draws the lifecycle of a job as a bar of width characters
+// spanning its creation to its completion, or to now if it is still
+// running: dots while it was queued, equal signs while it ran, and an
+// arrow at the end while it has not completed. E.g.
+//
+//	[......==============] finished
+//	[..........=========>] running
+func jobTimeline(job *bsubio.Job, now time.Time, width int) string {
+	if job.CreatedAt == nil {
+		return ""
+	}
+
+	done := jobDone(job)
+	end := now
+	if done && job.FinishedAt != nil {
+		end = *job.FinishedAt
+	}
+
+	claimed := end
+	if job.ClaimedAt != nil && job.ClaimedAt.Before(end) {
+		claimed = *job.ClaimedAt
+	}
+
+	total := end.Sub(*job.CreatedAt)
+	queue, run := claimed.Sub(*job.CreatedAt), end.Sub(claimed)
+
+	// Split the bar in proportion to the time spent in each state, giving
+	// every state the job went through at least one character
+	bar := width
+	if !done {
+		bar--
+	}
+	queueChars := bar
+	if job.ClaimedAt != nil {
+		queueChars = 0
+		if total > 0 {
+			queueChars = int(float64(bar) * float64(queue) / float64(total))
+		}
+		if queue > 0 && queueChars == 0 {
+			queueChars = 1
+		}
+		if run > 0 && queueChars == bar {
+			queueChars = bar - 1
+		}
+	}
+	runChars := bar - queueChars
+
+	var b strings.Builder
+	b.WriteByte('[')
+	b.WriteString(strings.Repeat(".", queueChars))
+	b.WriteString(strings.Repeat("=", runChars))
+
+	label := string(derefStatus(job.Status))
+	switch {
+	case done:
+	case job.ClaimedAt != nil:
+		b.WriteByte('>')
+		label = "running"
+	default:
+		b.WriteByte('>')
+		label = "queued"
+	}
+	b.WriteString("] ")
+	b.WriteString(label)
+
+	return b.String()
+}
+
+// jobDone reports whether a job has finished or failed
+func jobDone(job *bsubio.Job) bool {
+	status := derefStatus(job.Status)
+	return status == bsubio.JobStatusFinished || status == bsubio.JobStatusFailed
+}
+
+// derefStatus returns a job status, or "" if it is unknown
+func derefStatus(s *bsubio.JobStatus) bsubio.JobStatus {
+	if s == nil {
+		return ""
+	}
+	return *s
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bsubio/bsubio-go"
+)
+
+func TestJobTimeline(t *testing.T) {
+	created := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := created.Add(d)
+		return &t
+	}
+	status := func(s bsubio.JobStatus) *bsubio.JobStatus { return &s }
+	now := created.Add(10 * time.Second)
+
+	tests := []struct {
+		name string
+		job  bsubio.Job
+		want string
+	}{
+		{
+			"finished",
+			bsubio.Job{Status: status(bsubio.JobStatusFinished), CreatedAt: at(0), ClaimedAt: at(2 * time.Second), FinishedAt: at(10 * time.Second)},
+			"[..========] finished",
+		},
+		{
+			"running",
+			bsubio.Job{Status: status(bsubio.JobStatusClaimed), CreatedAt: at(0), ClaimedAt: at(5 * time.Second)},
+			"[....=====>] running",
+		},
+		{
+			"queued",
+			bsubio.Job{Status: status(bsubio.JobStatusPending), CreatedAt: at(0)},
+			"[.........>] queued",
+		},
+		{
+			"short queue",
+			bsubio.Job{Status: status(bsubio.JobStatusFailed), CreatedAt: at(0), ClaimedAt: at(time.Millisecond), FinishedAt: at(10 * time.Second)},
+			"[.=========] failed",
+		},
+		{
+			"short run",
+			bsubio.Job{Status: status(bsubio.JobStatusFinished), CreatedAt: at(0), ClaimedAt: at(10*time.Second - time.Millisecond), FinishedAt: at(10 * time.Second)},
+			"[.........=] finished",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := jobTimeline(&tt.job, now, 10); got != tt.want {
+			t.Errorf("%s: jobTimeline() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -1,9 +1,19 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"flag"
 	"fmt"
+	"io"
+	"mime"
+	"net/http"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bsubio/bsubio-go"
 )
 
 func runSubmit(args []string) error {
@@ -12,6 +22,12 @@ func runSubmit(args []string) error {
 	// Define flags
 	wait := fs.Bool("w", false, "Wait for job to complete")
 	outputFile := fs.String("o", "", "Output file path (requires -w)")
+	name := fs.String("name", "", "File name to send with the input (default: input file name)")
+	jobName := fs.String("job-name", "", "Local name for the job, usable instead of its ID in other commands")
+	mimeType := fs.String("mime", "", "MIME type of the input (default: guessed from its content and file name)")
+	noCache := fs.Bool("no-cache", false, "Do not use the local result cache")
+	force := fs.Bool("force", false, "Submit even if the job type does not accept the input's MIME type")
+	cancelOnInterrupt := fs.Bool("cancel-on-interrupt", false, "Cancel the job if waiting is interrupted with Ctrl-C (requires -w)")
 
 	// Custom usage function
 	fs.Usage = func() {
@@ -20,20 +36,20 @@ func runSubmit(args []string) error {
 		fmt.Fprintf(fs.Output(), "Options:\n")
 		fs.PrintDefaults()
 		fmt.Fprintf(fs.Output(), "\nArguments:\n")
-		fmt.Fprintf(fs.Output(), "  type          Job type (e.g., pdf_extract)\n")
-		fmt.Fprintf(fs.Output(), "  input_file    Path to the input file\n")
+		fmt.Fprintf(fs.Output(), "  type          Job type (e.g., pdf_extract), or auto to pick it from the input\n")
+		fmt.Fprintf(fs.Output(), "  input_file    Path to the input file, or - to read from stdin\n")
 	}
 
 	// Parse flags
 	if err := fs.Parse(args); err != nil {
-		return err
+		return usageError(err)
 	}
 
 	// Get remaining arguments
 	remainingArgs := fs.Args()
 	if len(remainingArgs) != 2 {
 		fs.Usage()
-		return fmt.Errorf("expected 2 arguments, got %d", len(remainingArgs))
+		return usageErrorf("expected 2 arguments, got %d", len(remainingArgs))
 	}
 
 	jobType := remainingArgs[0]
@@ -41,15 +57,55 @@ func runSubmit(args []string) error {
 
 	// Validate that output file is only used with wait
 	if *outputFile != "" && !*wait {
-		return fmt.Errorf("-o flag requires -w flag")
+		return usageErrorf("-o flag requires -w flag")
+	}
+
+	if *cancelOnInterrupt && !*wait {
+		return usageErrorf("--cancel-on-interrupt flag requires -w flag")
 	}
 
-	// Check if input file exists
-	if _, err := os.Stat(inputFile); err != nil {
-		if os.IsNotExist(err) {
-			return fmt.Errorf("input file not found: %s", inputFile)
+	if *jobName != "" {
+		if err := validJobName(*jobName); err != nil {
+			return usageError(err)
+		}
+	}
+
+	// Open input (stdin or file)
+	var input io.Reader = os.Stdin
+	var inputSize int64
+	if inputFile != "-" {
+		file, err := os.Open(inputFile)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("input file not found: %s", inputFile)
+			}
+			return fmt.Errorf("failed to access input file: %w", err)
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+		input = file
+
+		if info, err := file.Stat(); err == nil {
+			inputSize = info.Size()
+		}
+
+		if *name == "" {
+			*name = filepath.Base(inputFile)
+		}
+	}
+
+	// Peek at the start of the input to sniff its MIME type
+	buffered := bufio.NewReader(input)
+	head, _ := buffered.Peek(512)
+	input = buffered
+
+	inputMIMEs := []string{*mimeType}
+	if *mimeType == "" {
+		inputMIMEs = sniffMIME(*name, head)
+		if len(inputMIMEs) > 0 {
+			*mimeType = inputMIMEs[0]
 		}
-		return fmt.Errorf("failed to access input file: %w", err)
 	}
 
 	// Create client
@@ -60,62 +116,249 @@ func runSubmit(args []string) error {
 
 	ctx := getContext()
 
+	// Make sure the job type accepts the input before uploading it
+	if jobType == "auto" || !*force {
+		types, err := fetchTypes(ctx, client)
+		if err != nil {
+			return err
+		}
+
+		// The type may be missing from cached job types if it is new
+		if _, ok := findType(types, jobType); !ok && jobType != "auto" {
+			if types, err = refreshTypes(ctx, client); err != nil {
+				return err
+			}
+		}
+
+		if jobType == "auto" {
+			jobType, err = pickTypeForInput(types, inputMIMEs)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Selected job type: %s\n", jobType)
+		} else if err := checkInputMIME(types, jobType, inputMIMEs); err != nil {
+			return err
+		}
+	}
+
+	// With -w, identical inputs already processed by this server version
+	// are served from the result cache instead of being submitted again
+	var (
+		cache *resultCache
+		entry cacheEntry
+	)
+	if *wait && inputFile != "-" {
+		var version string
+		cache, version = openCacheForServer(ctx, client, *noCache)
+		if cache != nil {
+			entry, err = entryForFile(inputFile, jobType, version)
+			if err != nil {
+				return err
+			}
+
+			if hit, path, ok := cache.lookup(entry.Key); ok {
+				fmt.Fprintf(os.Stderr, "Using cached output of job %s\n", hit.JobID)
+				recordJobName(hit.JobID, *jobName)
+				return writeCachedOutput(path, *outputFile)
+			}
+		}
+	}
+
 	// Submit job
 	fmt.Fprintf(os.Stderr, "Submitting job...\n")
-	job, err := client.CreateAndSubmitJobFromFile(ctx, jobType, inputFile)
+	inputPath := inputFile
+	if inputFile == "-" {
+		inputPath = ""
+	}
+	bar := newProgressBar("Uploading", inputSize)
+	job, err := submitJob(ctx, client, jobType, &progressReader{r: input, bar: bar}, *name, *mimeType, inputPath)
+	bar.Finish()
 	if err != nil {
 		return fmt.Errorf("failed to submit job: %w", err)
 	}
 
 	fmt.Fprintf(os.Stderr, "Job submitted: %s\n", *job.Id)
+	recordJobName(job.Id.String(), *jobName)
 
 	// If wait flag is set, wait for completion and get output
 	if *wait {
 		fmt.Fprintf(os.Stderr, "Waiting for job to complete...\n")
-		finishedJob, err := client.WaitForJob(ctx, *job.Id)
+		finishedJob, err := waitForJob(ctx, client, *job.Id)
 		if err != nil {
+			handleInterruptedWait(client, *cancelOnInterrupt, *job.Id)
 			return fmt.Errorf("failed to wait for job: %w", err)
 		}
+		recordJobStatus(finishedJob)
 
 		if finishedJob.Status != nil && *finishedJob.Status == "failed" {
-			if finishedJob.ErrorMessage != nil {
-				return fmt.Errorf("job failed: %s", *finishedJob.ErrorMessage)
-			}
-			return fmt.Errorf("job failed")
+			return jobFailedError(*job.Id, finishedJob.ErrorMessage)
 		}
 
 		fmt.Fprintf(os.Stderr, "Job completed successfully\n")
 
-		// Get output
-		outputResp, err := client.GetJobOutput(ctx, *job.Id)
-		if err != nil {
-			return fmt.Errorf("failed to get job output: %w", err)
-		}
-		defer func() {
-			_ = outputResp.Body.Close()
-		}()
-
-		// Write output to file or stdout
-		if *outputFile != "" {
-			file, err := os.Create(*outputFile)
+		// Get output, keeping a copy in the result cache
+		if cache != nil {
+			path, cached, err := cache.storeJobOutput(ctx, client, *job.Id, entry, true)
 			if err != nil {
-				return fmt.Errorf("failed to create output file: %w", err)
+				return err
 			}
-			defer func() {
-				_ = file.Close()
-			}()
-
-			if _, err := file.ReadFrom(outputResp.Body); err != nil {
-				return fmt.Errorf("failed to write output file: %w", err)
+			if !cached {
+				defer func() {
+					_ = os.Remove(path)
+				}()
 			}
+			return writeCachedOutput(path, *outputFile)
+		}
 
-			fmt.Fprintf(os.Stderr, "Output saved to %s\n", *outputFile)
-		} else {
-			if _, err := os.Stdout.ReadFrom(outputResp.Body); err != nil {
-				return fmt.Errorf("failed to write output: %w", err)
-			}
+		return writeOutput(ctx, client, *job.Id, *outputFile)
+	}
+
+	return nil
+}
+
+// writeOutput downloads the output of a finished job into a file, or
+// streams it to stdout if outputFile is empty
+func writeOutput(ctx context.Context, client *bsubio.BsubClient, jobID bsubio.JobId, outputFile string) error {
+	if outputFile != "" {
+		if err := downloadJobOutput(ctx, client, jobID, outputFile, true); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Output saved to %s\n", outputFile)
+		return nil
+	}
+
+	outputResp, err := client.GetJobOutput(ctx, jobID)
+	if err != nil {
+		return fmt.Errorf("failed to get job output: %w", err)
+	}
+	defer func() {
+		_ = outputResp.Body.Close()
+	}()
+
+	if outputResp.StatusCode != 200 {
+		return httpErrorf(outputResp.StatusCode, "failed to get job output")
+	}
+
+	if _, err := os.Stdout.ReadFrom(outputResp.Body); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+
+	return nil
+}
+
+// writeCachedOutput copies a cached job output to a file, or to stdout if
+// outputFile is empty
+func writeCachedOutput(path, outputFile string) error {
+	if outputFile == "" {
+		if err := copyFileTo(os.Stdout, path); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
 		}
+		return nil
+	}
+
+	err := writeFileAtomic(outputFile, func(w io.Writer) error {
+		return copyFileTo(w, path)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
 	}
 
+	fmt.Fprintf(os.Stderr, "Output saved to %s\n", outputFile)
 	return nil
 }
+
+// genericMIMETypes are the types http.DetectContentType reports for content
+// it cannot identify further, like plain text or ZIP archives, which many
+// formats are built on
+var genericMIMETypes = []string{
+	"application/octet-stream",
+	"application/zip",
+	"text/plain",
+	"text/xml",
+}
+
+// sniffMIME guesses the MIME type of an input from its file name and the
+// first bytes of its content, best guess first. A specific type found in the
+// content wins over the file name, so a PNG named x.pdf is still a PNG.
+// Otherwise the type of the file extension comes first, as content sniffing
+// cannot tell apart many text formats.
+func sniffMIME(name string, head []byte) []string {
+	var guesses []string
+
+	add := func(mimeType string) {
+		mediaType, _, err := mime.ParseMediaType(mimeType)
+		if err != nil || slices.Contains(guesses, mediaType) {
+			return
+		}
+		guesses = append(guesses, mediaType)
+	}
+
+	var sniffed string
+	if len(head) > 0 {
+		sniffed = http.DetectContentType(head)
+		mediaType, _, err := mime.ParseMediaType(sniffed)
+		if err == nil && !slices.Contains(genericMIMETypes, mediaType) {
+			return []string{mediaType}
+		}
+	}
+
+	add(mime.TypeByExtension(filepath.Ext(name)))
+	add(sniffed)
+
+	return guesses
+}
+
+// checkInputMIME returns an error if the job type does not accept any of the
+// MIME types guessed for the input
+func checkInputMIME(types []bsubio.ProcessingType, jobType string, inputMIMEs []string) error {
+	t, ok := findType(types, jobType)
+	if !ok {
+		return fmt.Errorf("unknown job type: %s\nRun 'bsubio types' to list available types, or use --force", jobType)
+	}
+
+	if len(inputMIMEs) == 0 {
+		return nil
+	}
+
+	if ok, _ := typeAccepts(t, inputMIMEs); ok {
+		return nil
+	}
+
+	return fmt.Errorf("input looks like %s, but %s accepts %s\nUse --mime to declare the input type, or --force to submit anyway",
+		strings.Join(inputMIMEs, " or "), jobType, strings.Join(typeMimeIn(t), ", "))
+}
+
+// pickTypeForInput chooses the job type for "submit auto". Types listing the
+// input's MIME type explicitly win over types accepting it via a wildcard.
+func pickTypeForInput(types []bsubio.ProcessingType, inputMIMEs []string) (string, error) {
+	if len(inputMIMEs) == 0 {
+		return "", fmt.Errorf("cannot detect the input's MIME type; use --mime or choose a job type")
+	}
+
+	var exact, matching []string
+	for _, t := range types {
+		ok, isExact := typeAccepts(t, inputMIMEs)
+		if !ok {
+			continue
+		}
+		matching = append(matching, derefString(t.Type))
+		if isExact {
+			exact = append(exact, derefString(t.Type))
+		}
+	}
+
+	switch {
+	case len(exact) == 1:
+		return exact[0], nil
+	case len(exact) > 1:
+		return "", fmt.Errorf("several job types accept %s: %s\nChoose one of them instead of auto",
+			strings.Join(inputMIMEs, " or "), strings.Join(exact, ", "))
+	case len(matching) == 1:
+		return matching[0], nil
+	case len(matching) > 1:
+		return "", fmt.Errorf("several job types accept %s: %s\nChoose one of them instead of auto",
+			strings.Join(inputMIMEs, " or "), strings.Join(matching, ", "))
+	default:
+		return "", fmt.Errorf("no job type accepts %s", strings.Join(inputMIMEs, " or "))
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSniffMIME(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	pdf := []byte("%PDF-1.7\n")
+
+	tests := []struct {
+		name     string
+		fileName string
+		head     []byte
+		want     []string
+	}{
+		{"content matches name", "x.pdf", pdf, []string{"application/pdf"}},
+		{"content overrides name", "x.pdf", png, []string{"image/png"}},
+		{"content without name", "", png, []string{"image/png"}},
+		{"text content keeps name", "x.json", []byte(`{"a": 1}`), []string{"application/json", "text/plain"}},
+		{"xml content keeps name", "x.svg", []byte(`<?xml version="1.0"?><svg/>`), []string{"image/svg+xml", "text/xml"}},
+		{"unknown name and content", "x.unknown", []byte{0, 1, 2}, []string{"application/octet-stream"}},
+		{"empty input", "x.pdf", nil, []string{"application/pdf"}},
+		{"nothing known", "", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sniffMIME(tt.fileName, tt.head); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sniffMIME(%q) = %v, want %v", tt.fileName, got, tt.want)
+			}
+		})
+	}
+}
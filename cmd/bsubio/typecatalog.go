@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bsubio/bsubio-go"
+)
+
+// The job types of the server change rarely, so they are cached on disk and
+// fetched again once the cache is older than defaultTypesCacheTTL, or the
+// config's types_cache_ttl. The cache keeps the types as the API returned
+// them, fields the CLI does not know about included.
+const defaultTypesCacheTTL = time.Hour
+
+// typeCatalog is the cached list of job types of a server
+type typeCatalog struct {
+	BaseURL   string            `json:"base_url"`
+	FetchedAt time.Time         `json:"fetched_at"`
+	Types     []json.RawMessage `json:"types"`
+}
+
+// typeCatalogPath returns the path of the job type cache
+func typeCatalogPath() (string, error) {
+	dir, err := getCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "types.json"), nil
+}
+
+// fresh reports whether the catalog was fetched from baseURL less than ttl
+// ago
+func (c *typeCatalog) fresh(baseURL string, ttl time.Duration, now time.Time) bool {
+	if c.BaseURL != baseURL || ttl <= 0 {
+		return false
+	}
+	age := now.Sub(c.FetchedAt)
+	return age >= 0 && age < ttl
+}
+
+// parse returns the job types of the catalog
+func (c *typeCatalog) parse() ([]bsubio.ProcessingType, error) {
+	types := make([]bsubio.ProcessingType, len(c.Types))
+	for i, raw := range c.Types {
+		if err := json.Unmarshal(raw, &types[i]); err != nil {
+			return nil, fmt.Errorf("failed to parse job type: %w", err)
+		}
+	}
+	return types, nil
+}
+
+// find looks up a job type by name, returning it parsed and as the API
+// returned it
+func (c *typeCatalog) find(name string) (bsubio.ProcessingType, json.RawMessage, bool, error) {
+	types, err := c.parse()
+	if err != nil {
+		return bsubio.ProcessingType{}, nil, false, err
+	}
+	for i, t := range types {
+		if derefString(t.Type) == name {
+			return t, c.Types[i], true, nil
+		}
+	}
+	return bsubio.ProcessingType{}, nil, false, nil
+}
+
+// typesCacheTTL returns how long cached job types are used
+func typesCacheTTL(config *Config) (time.Duration, error) {
+	if config.TypesCacheTTL == "" {
+		return defaultTypesCacheTTL, nil
+	}
+	ttl, err := parseAge(config.TypesCacheTTL)
+	if err != nil {
+		return 0, fmt.Errorf("invalid types_cache_ttl in config: %w", err)
+	}
+	return ttl, nil
+}
+
+// loadTypeCatalog returns the job types of the server, from the cache when
+// it is fresh enough, unless refresh is set. When the server cannot be
+// reached, an outdated cache is used after printing a warning.
+func loadTypeCatalog(ctx context.Context, client *bsubio.BsubClient, refresh bool) (*typeCatalog, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	ttl, err := typesCacheTTL(config)
+	if err != nil {
+		return nil, err
+	}
+
+	path, pathErr := typeCatalogPath()
+
+	var cached *typeCatalog
+	if pathErr == nil {
+		cached = readTypeCatalog(path, config.BaseURL)
+	}
+	if cached != nil && !refresh && cached.fresh(config.BaseURL, ttl, time.Now()) {
+		return cached, nil
+	}
+
+	catalog, err := fetchTypeCatalog(ctx, client)
+	if err != nil {
+		kind := classifyError(err)
+		if cached == nil || (kind != kindNetwork && kind != kindServer && kind != kindTimeout) {
+			return nil, err
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %v; using job types cached %s ago\n", err,
+			formatJobDuration(time.Since(cached.FetchedAt), true))
+		return cached, nil
+	}
+	catalog.BaseURL = config.BaseURL
+
+	// The cache only saves requests, so failing to write it is not an error
+	if pathErr == nil && ttl > 0 {
+		_ = os.MkdirAll(filepath.Dir(path), 0700)
+		_ = writeFileAtomic(path, func(w io.Writer) error {
+			return json.NewEncoder(w).Encode(catalog)
+		})
+	}
+
+	return catalog, nil
+}
+
+// readTypeCatalog returns the cached job types of baseURL, or nil if there
+// are none
+func readTypeCatalog(path, baseURL string) *typeCatalog {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	var c typeCatalog
+	if err := json.Unmarshal(data, &c); err != nil || c.BaseURL != baseURL {
+		return nil
+	}
+	return &c
+}
+
+// fetchTypeCatalog gets the job types from the server
+func fetchTypeCatalog(ctx context.Context, client *bsubio.BsubClient) (*typeCatalog, error) {
+	resp, err := client.GetTypesWithResponse(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job types: %w", err)
+	}
+
+	if resp.StatusCode() != 200 {
+		return nil, httpErrorf(resp.StatusCode(), "failed to get job types")
+	}
+
+	// The raw response is kept rather than resp.JSON200, so no field is lost
+	var body struct {
+		Types []json.RawMessage `json:"types"`
+	}
+	if err := json.Unmarshal(resp.Body, &body); err != nil || body.Types == nil {
+		return nil, fmt.Errorf("unexpected response format")
+	}
+
+	return &typeCatalog{FetchedAt: time.Now(), Types: body.Types}, nil
+}
+
+// fetchTypes returns the job types available on the server
+func fetchTypes(ctx context.Context, client *bsubio.BsubClient) ([]bsubio.ProcessingType, error) {
+	catalog, err := loadTypeCatalog(ctx, client, false)
+	if err != nil {
+		return nil, err
+	}
+	return catalog.parse()
+}
+
+// refreshTypes returns the job types available on the server, fetching
+// them again even if the cache is fresh
+func refreshTypes(ctx context.Context, client *bsubio.BsubClient) ([]bsubio.ProcessingType, error) {
+	catalog, err := loadTypeCatalog(ctx, client, true)
+	if err != nil {
+		return nil, err
+	}
+	return catalog.parse()
+}
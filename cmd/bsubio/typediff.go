@@ -0,0 +1,400 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/bsubio/bsubio-go"
+)
+
+// types snapshot saves the job types of the server, and types diff compares
+// them with a snapshot. A change is breaking when a tool built against the
+// snapshot may stop working: a type was removed, stopped accepting or
+// producing a MIME type, or changed its output extension.
+
+// typeChange describes how a job type differs from a snapshot
+type typeChange struct {
+	Type     string
+	Kind     string // "added", "removed" or "changed"
+	Breaking bool
+	Details  []typeChangeDetail
+}
+
+// typeChangeDetail is a single change of a field of a job type
+type typeChangeDetail struct {
+	Text     string
+	Breaking bool
+}
+
+func runTypesSnapshot(args []string) error {
+	fs := flag.NewFlagSet("types snapshot", flag.ContinueOnError)
+
+	// Custom usage function
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bsubio types snapshot > types.json\n\n")
+		fmt.Fprintf(fs.Output(), "Print the job types of the server, to compare with 'bsubio types diff' later\n")
+	}
+
+	// Parse flags
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return usageErrorf("expected 0 arguments, got %d", fs.NArg())
+	}
+
+	catalog, err := fetchLiveTypeCatalog()
+	if err != nil {
+		return err
+	}
+
+	// Sorting the types keeps snapshots in version control easy to compare
+	types, err := catalog.parse()
+	if err != nil {
+		return err
+	}
+	order := make([]int, len(types))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return derefString(types[order[a]].Type) < derefString(types[order[b]].Type)
+	})
+	sorted := make([]json.RawMessage, len(order))
+	for i, j := range order {
+		sorted[i] = catalog.Types[j]
+	}
+	catalog.Types = sorted
+
+	data, err := json.MarshalIndent(catalog, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal output: %w", err)
+	}
+	_, err = fmt.Printf("%s\n", data)
+	return err
+}
+
+func runTypesDiff(args []string) error {
+	fs := flag.NewFlagSet("types diff", flag.ContinueOnError)
+
+	// Define flags
+	strict := fs.Bool("strict", false, "Exit with an error on any change, not only on breaking ones")
+
+	// Custom usage function
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bsubio types diff [options] <snapshot> [<snapshot>]\n\n")
+		fmt.Fprintf(fs.Output(), "Compare the job types of the server with a snapshot, and exit with\n")
+		fmt.Fprintf(fs.Output(), "status 10 on breaking changes\n\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "\nArguments:\n")
+		fmt.Fprintf(fs.Output(), "  snapshot    File written by 'bsubio types snapshot', or - for stdin.\n")
+		fmt.Fprintf(fs.Output(), "              With two snapshots, the second is compared with the first.\n")
+	}
+
+	// Parse flags
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	if fs.NArg() != 1 && fs.NArg() != 2 {
+		fs.Usage()
+		return usageErrorf("expected 1 or 2 arguments, got %d", fs.NArg())
+	}
+
+	old, err := readTypeSnapshot(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var current *typeCatalog
+	if fs.NArg() == 2 {
+		current, err = readTypeSnapshot(fs.Arg(1))
+	} else {
+		current, err = fetchLiveTypeCatalog()
+	}
+	if err != nil {
+		return err
+	}
+
+	changes, err := diffTypes(old.Types, current.Types)
+	if err != nil {
+		return err
+	}
+
+	if len(changes) == 0 {
+		fmt.Fprintf(os.Stderr, "No changes (%d job type(s))\n", len(current.Types))
+		return nil
+	}
+
+	printTypeChanges(os.Stdout, changes)
+
+	counts := make(map[string]int)
+	breaking := 0
+	for _, c := range changes {
+		counts[c.Kind]++
+		if c.Breaking {
+			breaking++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "\n%d added, %d removed, %d changed, %d breaking\n",
+		counts["added"], counts["removed"], counts["changed"], breaking)
+
+	// A dedicated exit code tells changes apart from failing to compare
+	switch {
+	case breaking > 0:
+		return errorf(kindTypesChanged, "%d breaking change(s) to job types", breaking)
+	case *strict:
+		return errorf(kindTypesChanged, "%d change(s) to job types", len(changes))
+	}
+
+	return nil
+}
+
+// fetchLiveTypeCatalog gets the job types from the server, bypassing the
+// cache, which could be outdated
+func fetchLiveTypeCatalog() (*typeCatalog, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := createClient()
+	if err != nil {
+		return nil, err
+	}
+
+	catalog, err := fetchTypeCatalog(getContext(), client)
+	if err != nil {
+		return nil, err
+	}
+	catalog.BaseURL = config.BaseURL
+
+	return catalog, nil
+}
+
+// readTypeSnapshot reads a snapshot written by types snapshot. A GetTypes
+// response saved as is works too.
+func readTypeSnapshot(path string) (*typeCatalog, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	var c typeCatalog
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot %s: %w", path, err)
+	}
+	if c.Types == nil {
+		return nil, fmt.Errorf("failed to parse snapshot %s: no \"types\" list", path)
+	}
+
+	return &c, nil
+}
+
+// diffTypes compares job types with the ones of a snapshot, returning the
+// changes ordered by type
+func diffTypes(old, current []json.RawMessage) ([]typeChange, error) {
+	oldTypes, err := indexTypes(old)
+	if err != nil {
+		return nil, err
+	}
+	currentTypes, err := indexTypes(current)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []typeChange
+	for name, o := range oldTypes {
+		c, ok := currentTypes[name]
+		if !ok {
+			changes = append(changes, typeChange{Type: name, Kind: "removed", Breaking: true})
+			continue
+		}
+
+		details, err := diffType(o, c)
+		if err != nil {
+			return nil, fmt.Errorf("job type %s: %w", name, err)
+		}
+		if len(details) == 0 {
+			continue
+		}
+
+		change := typeChange{Type: name, Kind: "changed", Details: details}
+		for _, d := range details {
+			if d.Breaking {
+				change.Breaking = true
+			}
+		}
+		changes = append(changes, change)
+	}
+
+	for name := range currentTypes {
+		if _, ok := oldTypes[name]; !ok {
+			changes = append(changes, typeChange{Type: name, Kind: "added"})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Type < changes[j].Type
+	})
+
+	return changes, nil
+}
+
+// indexTypes maps job types to their raw JSON by name. Types without a name
+// or listed twice are errors, as they cannot be compared.
+func indexTypes(raw []json.RawMessage) (map[string]json.RawMessage, error) {
+	index := make(map[string]json.RawMessage, len(raw))
+	for i, r := range raw {
+		var t bsubio.ProcessingType
+		if err := json.Unmarshal(r, &t); err != nil {
+			return nil, fmt.Errorf("failed to parse job type: %w", err)
+		}
+
+		name := derefString(t.Type)
+		if name == "" {
+			return nil, fmt.Errorf("job type %d has no name", i+1)
+		}
+		if _, ok := index[name]; ok {
+			return nil, fmt.Errorf("job type %s is listed more than once", name)
+		}
+		index[name] = r
+	}
+	return index, nil
+}
+
+// diffType compares two versions of a job type. MIME types are compared as
+// sets of patterns, so that a wildcard covers the types it matches; other
+// fields by their value.
+func diffType(old, current json.RawMessage) ([]typeChangeDetail, error) {
+	var o, c bsubio.ProcessingType
+	if err := json.Unmarshal(old, &o); err != nil {
+		return nil, fmt.Errorf("failed to parse job type: %w", err)
+	}
+	if err := json.Unmarshal(current, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse job type: %w", err)
+	}
+
+	var details []typeChangeDetail
+
+	// Types without input MIME types accept anything
+	oldIn, currentIn := typeMimeIn(o), typeMimeIn(c)
+	switch {
+	case len(oldIn) == 0 && len(currentIn) > 0:
+		details = append(details, typeChangeDetail{"only accepts " + strings.Join(currentIn, ", ") + " (used to accept anything)", true})
+	case len(oldIn) > 0 && len(currentIn) == 0:
+		details = append(details, typeChangeDetail{"accepts anything (used to accept " + strings.Join(oldIn, ", ") + ")", false})
+	default:
+		for _, m := range uncovered(oldIn, currentIn) {
+			details = append(details, typeChangeDetail{"no longer accepts " + m, true})
+		}
+		for _, m := range uncovered(currentIn, oldIn) {
+			details = append(details, typeChangeDetail{"now accepts " + m, false})
+		}
+	}
+
+	// Outputs are the reverse of inputs: tooling handles what a type used
+	// to produce, so producing less is safe and producing more is not,
+	// unless the type never said what it produces
+	oldOut, currentOut := typeMimeOut(o), typeMimeOut(c)
+	for _, m := range uncovered(oldOut, currentOut) {
+		details = append(details, typeChangeDetail{"no longer produces " + m, false})
+	}
+	for _, m := range uncovered(currentOut, oldOut) {
+		details = append(details, typeChangeDetail{"now produces " + m, len(oldOut) > 0})
+	}
+
+	oldFields, err := flatTypeFields(old)
+	if err != nil {
+		return nil, err
+	}
+	currentFields, err := flatTypeFields(current)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(oldFields)+len(currentFields))
+	for path := range oldFields {
+		paths = append(paths, path)
+	}
+	for path := range currentFields {
+		if _, ok := oldFields[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if path == "input.mime_in" || path == "output.mime_out" {
+			continue
+		}
+
+		// Tools name output files after the extension
+		breaking := path == "output.ext"
+
+		o, inOld := oldFields[path]
+		c, inCurrent := currentFields[path]
+		switch {
+		case !inOld:
+			details = append(details, typeChangeDetail{fmt.Sprintf("%s added: %q", path, c), false})
+		case !inCurrent:
+			details = append(details, typeChangeDetail{fmt.Sprintf("%s removed (was %q)", path, o), breaking})
+		case o != c:
+			details = append(details, typeChangeDetail{fmt.Sprintf("%s changed: %q -> %q", path, o, c), breaking})
+		}
+	}
+
+	return details, nil
+}
+
+// uncovered returns the MIME types or patterns of a that no pattern of b
+// covers, e.g. application/pdf is covered by application/* and */*
+func uncovered(a, b []string) []string {
+	var out []string
+	for _, m := range a {
+		if !slices.ContainsFunc(b, func(pattern string) bool { return mimeMatch(pattern, m) }) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// printTypeChanges lists the changes to job types, marking breaking ones
+func printTypeChanges(w io.Writer, changes []typeChange) {
+	for _, c := range changes {
+		mark := map[string]string{"added": "+", "removed": "-", "changed": "~"}[c.Kind]
+		line := fmt.Sprintf("%s %s", mark, c.Type)
+		if c.Kind != "changed" {
+			line += " (" + c.Kind + ")"
+		}
+		if c.Breaking && c.Kind != "changed" {
+			line += " [breaking]"
+		}
+		fmt.Fprintln(w, line)
+
+		for _, d := range c.Details {
+			if d.Breaking {
+				fmt.Fprintf(w, "    %s [breaking]\n", d.Text)
+			} else {
+				fmt.Fprintf(w, "    %s\n", d.Text)
+			}
+		}
+	}
+}
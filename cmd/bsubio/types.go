@@ -1,7 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/bsubio/bsubio-go"
 )
 
 func derefString(s *string) string {
@@ -11,7 +20,72 @@ func derefString(s *string) string {
 	return *s
 }
 
+// typeColumns are the CSV columns of job types; lists of MIME types are
+// separated by spaces
+var typeColumns = []outputColumn[bsubio.ProcessingType]{
+	{"type", func(t bsubio.ProcessingType) string { return derefString(t.Type) }},
+	{"name", func(t bsubio.ProcessingType) string { return derefString(t.Name) }},
+	{"description", func(t bsubio.ProcessingType) string { return derefString(t.Description) }},
+	{"mime_in", func(t bsubio.ProcessingType) string { return strings.Join(typeMimeIn(t), " ") }},
+	{"mime_out", func(t bsubio.ProcessingType) string { return strings.Join(typeMimeOut(t), " ") }},
+	{"ext", func(t bsubio.ProcessingType) string {
+		if t.Output == nil {
+			return ""
+		}
+		return derefString(t.Output.Ext)
+	}},
+}
+
 func runTypes(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "describe":
+			return runTypesDescribe(args[1:])
+		case "snapshot":
+			return runTypesSnapshot(args[1:])
+		case "diff":
+			return runTypesDiff(args[1:])
+		}
+	}
+
+	fs := flag.NewFlagSet("types", flag.ContinueOnError)
+
+	// Define flags
+	accepts := fs.String("accepts", "", "Only list types accepting this MIME type (e.g., application/pdf)")
+	produces := fs.String("produces", "", "Only list types producing this MIME type (e.g., text/plain)")
+	refresh := fs.Bool("refresh", false, "Fetch the job types from the server even if they are cached")
+	jsonOut := fs.Bool("json", false, "Same as --output json")
+	out := addOutputFlags(fs)
+
+	// Custom usage function
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bsubio types [options]\n")
+		fmt.Fprintf(fs.Output(), "       bsubio types describe [options] <type>\n")
+		fmt.Fprintf(fs.Output(), "       bsubio types snapshot > types.json\n")
+		fmt.Fprintf(fs.Output(), "       bsubio types diff [options] <snapshot> [<snapshot>]\n\n")
+		fmt.Fprintf(fs.Output(), "List available job types\n\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	// Parse flags
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	if err := applyJSONFlag(out, *jsonOut); err != nil {
+		return err
+	}
+
+	if err := out.check(); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return usageErrorf("expected 0 arguments, got %d", fs.NArg())
+	}
+
 	// Create client
 	client, err := createClient()
 	if err != nil {
@@ -21,49 +95,352 @@ func runTypes(args []string) error {
 	ctx := getContext()
 
 	// Get available job types
-	resp, err := client.GetTypesWithResponse(ctx)
+	catalog, err := loadTypeCatalog(ctx, client, *refresh)
 	if err != nil {
-		return fmt.Errorf("failed to get job types: %w", err)
+		return err
 	}
 
-	if resp.StatusCode() != 200 {
-		return fmt.Errorf("failed to get job types: HTTP %d", resp.StatusCode())
+	all, err := catalog.parse()
+	if err != nil {
+		return err
 	}
 
-	if resp.JSON200 == nil || resp.JSON200.Types == nil {
-		return fmt.Errorf("unexpected response format")
+	var (
+		types []bsubio.ProcessingType
+		raw   []json.RawMessage
+	)
+	for i, t := range all {
+		if typeMatches(t, *accepts, *produces) {
+			types = append(types, t)
+			raw = append(raw, catalog.Types[i])
+		}
 	}
 
-	types := *resp.JSON200.Types
+	if !out.table() {
+		return printTypes(out, types, raw, true)
+	}
 
 	if len(types) == 0 {
-		fmt.Println("No job types available")
+		if *accepts != "" || *produces != "" {
+			fmt.Println("No job types match")
+		} else {
+			fmt.Println("No job types available")
+		}
 		return nil
 	}
 
-	fmt.Printf("%-20s %-20s %-20s %s\n", "Worker Type", "MIME in", "MIME out", "Description")
+	// Find the longest values for proper alignment
+	typeLen, inLen, outLen := len("TYPE"), len("ACCEPTS"), len("PRODUCES")
+	for _, t := range types {
+		typeLen = max(typeLen, len(derefString(t.Type)))
+		inLen = max(inLen, len(strings.Join(typeMimeIn(t), ", ")))
+		outLen = max(outLen, len(strings.Join(typeMimeOut(t), ", ")))
+	}
+
+	fmt.Printf("%-*s %-*s %-*s %s\n", typeLen, "TYPE", inLen, "ACCEPTS", outLen, "PRODUCES", "DESCRIPTION")
 	fmt.Println("--------------------------------------------------------------------------------")
 
-	for _, jobType := range types {
-		workerType := derefString(jobType.Type)
-		description := derefString(jobType.Description)
+	for _, t := range types {
+		fmt.Printf("%-*s %-*s %-*s %s\n",
+			typeLen, derefString(t.Type),
+			inLen, strings.Join(typeMimeIn(t), ", "),
+			outLen, strings.Join(typeMimeOut(t), ", "),
+			derefString(t.Description))
+	}
 
-		mimeOuts := []string{""}
-		if jobType.Output != nil && jobType.Output.MimeOut != nil {
-			mimeOuts = *jobType.Output.MimeOut
+	return nil
+}
+
+func runTypesDescribe(args []string) error {
+	fs := flag.NewFlagSet("types describe", flag.ContinueOnError)
+
+	// Define flags
+	refresh := fs.Bool("refresh", false, "Fetch the job types from the server even if they are cached")
+	jsonOut := fs.Bool("json", false, "Same as --output json")
+	out := addOutputFlags(fs)
+
+	// Custom usage function
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bsubio types describe [options] <type>\n\n")
+		fmt.Fprintf(fs.Output(), "Show every field of a job type\n\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "\nArguments:\n")
+		fmt.Fprintf(fs.Output(), "  type    Job type (e.g., pdf/extract)\n")
+	}
+
+	// Parse flags
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	if err := applyJSONFlag(out, *jsonOut); err != nil {
+		return err
+	}
+
+	if err := out.check(); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return usageErrorf("expected 1 argument, got %d", fs.NArg())
+	}
+	name := fs.Arg(0)
+
+	// Create client
+	client, err := createClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := getContext()
+
+	catalog, err := loadTypeCatalog(ctx, client, *refresh)
+	if err != nil {
+		return err
+	}
+
+	t, raw, ok, err := catalog.find(name)
+	if err == nil && !ok && !*refresh {
+		// The type may be missing from cached job types if it is new
+		if catalog, err = loadTypeCatalog(ctx, client, true); err != nil {
+			return err
 		}
+		t, raw, ok, err = catalog.find(name)
+	}
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errorf(kindNotFound, "unknown job type: %s\nRun 'bsubio types' to list available types", name)
+	}
+
+	if !out.table() {
+		return printTypes(out, []bsubio.ProcessingType{t}, []json.RawMessage{raw}, false)
+	}
+
+	fields, err := typeFields(raw)
+	if err != nil {
+		return err
+	}
 
-		mimeIns := []string{""}
-		if jobType.Input != nil && jobType.Input.MimeIn != nil {
-			mimeIns = *jobType.Input.MimeIn
+	width := 0
+	for _, f := range fields {
+		width = max(width, len(f.Label)+1)
+	}
+	for _, f := range fields {
+		fmt.Printf("%-*s %s\n", width, f.Label+":", f.Value)
+	}
+
+	return nil
+}
+
+// applyJSONFlag makes --json select --output json
+func applyJSONFlag(out *outputOptions, jsonOut bool) error {
+	if !jsonOut {
+		return nil
+	}
+	if out.Format != outputTable && out.Format != outputJSON {
+		return usageErrorf("--json cannot be used with --output %s", out.Format)
+	}
+	out.Format = outputJSON
+	return nil
+}
+
+// printTypes prints job types in a structured format. JSON and YAML show
+// the types as the API returned them, including fields the CLI does not
+// know about; CSV and templates use the parsed types.
+func printTypes(out *outputOptions, types []bsubio.ProcessingType, raw []json.RawMessage, list bool) error {
+	switch out.Format {
+	case outputJSON, outputJSONL, outputYAML:
+		return printItems(os.Stdout, out, raw, nil, list)
+	}
+	return printItems(os.Stdout, out, types, typeColumns, list)
+}
+
+// typeField is a field of a job type as shown by types describe
+type typeField struct {
+	Label string
+	Value string
+}
+
+// typeFieldLabels are the labels of the fields every job type has, in the
+// order they are shown. Other fields follow, labeled by their JSON path.
+var typeFieldLabels = []struct{ path, label string }{
+	{"type", "Type"},
+	{"name", "Name"},
+	{"description", "Description"},
+	{"input.mime_in", "Accepts"},
+	{"output.mime_out", "Produces"},
+	{"output.ext", "Extension"},
+	{"output.display", "Display"},
+	{"example.cmd", "Example"},
+	{"example.desc", "Example Description"},
+}
+
+// typeFields returns the fields of a job type as returned by the API
+func typeFields(raw json.RawMessage) ([]typeField, error) {
+	values, err := flatTypeFields(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields []typeField
+	for _, l := range typeFieldLabels {
+		if value, ok := values[l.path]; ok {
+			fields = append(fields, typeField{l.label, value})
+			delete(values, l.path)
+		}
+	}
+
+	paths := make([]string, 0, len(values))
+	for path := range values {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fields = append(fields, typeField{path, values[path]})
+	}
+
+	return fields, nil
+}
+
+// flatTypeFields returns the fields of a job type by their dotted path
+func flatTypeFields(raw json.RawMessage) (map[string]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("failed to parse job type: %w", err)
+	}
+
+	values := make(map[string]string)
+	flattenJSON("", v, values)
+	return values, nil
+}
+
+// flattenJSON stores the values of a decoded JSON document by their dotted
+// path. Lists of plain values are joined with commas, other lists are kept
+// as JSON.
+func flattenJSON(path string, v any, values map[string]string) {
+	switch v := v.(type) {
+	case nil:
+	case map[string]any:
+		for k, child := range v {
+			if path != "" {
+				k = path + "." + k
+			}
+			flattenJSON(k, child, values)
 		}
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			switch item.(type) {
+			case map[string]any, []any:
+				data, _ := json.Marshal(v)
+				values[path] = string(data)
+				return
+			}
+			items = append(items, fmt.Sprint(item))
+		}
+		values[path] = strings.Join(items, ", ")
+	default:
+		values[path] = fmt.Sprint(v)
+	}
+}
+
+// findType looks up a job type by name
+func findType(types []bsubio.ProcessingType, name string) (bsubio.ProcessingType, bool) {
+	for _, t := range types {
+		if derefString(t.Type) == name {
+			return t, true
+		}
+	}
+	return bsubio.ProcessingType{}, false
+}
+
+// typeMimeIn returns the input MIME types accepted by a job type
+func typeMimeIn(t bsubio.ProcessingType) []string {
+	if t.Input == nil || t.Input.MimeIn == nil {
+		return nil
+	}
+	return *t.Input.MimeIn
+}
 
-		for _, mimeIn := range mimeIns {
-			for _, mimeOut := range mimeOuts {
-				fmt.Printf("%-20s %-20s %-20s %s\n", workerType, mimeIn, mimeOut, description)
+// typeMimeOut returns the output MIME types produced by a job type
+func typeMimeOut(t bsubio.ProcessingType) []string {
+	if t.Output == nil || t.Output.MimeOut == nil {
+		return nil
+	}
+	return *t.Output.MimeOut
+}
+
+// mimeMatch reports whether mimeType matches an accepted MIME pattern, which
+// may be a wildcard such as "*/*" or "image/*". Parameters such as charset
+// are ignored.
+func mimeMatch(pattern, mimeType string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(strings.SplitN(pattern, ";", 2)[0]))
+	mimeType = strings.ToLower(strings.TrimSpace(strings.SplitN(mimeType, ";", 2)[0]))
+
+	if pattern == "" || mimeType == "" {
+		return false
+	}
+	if pattern == "*/*" || pattern == "*" || pattern == mimeType {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(mimeType, prefix+"/")
+	}
+	return false
+}
+
+// typeMatches reports whether a job type accepts and produces the given MIME
+// types, either of which may be a wildcard such as "image/*" or empty to
+// match any type. Types that do not advertise any input MIME types accept
+// everything.
+func typeMatches(t bsubio.ProcessingType, accepts, produces string) bool {
+	if accepts != "" {
+		in := typeMimeIn(t)
+		if len(in) > 0 && !slices.ContainsFunc(in, func(m string) bool { return mimeOverlap(m, accepts) }) {
+			return false
+		}
+	}
+
+	if produces != "" && !slices.ContainsFunc(typeMimeOut(t), func(m string) bool { return mimeOverlap(m, produces) }) {
+		return false
+	}
+
+	return true
+}
+
+// mimeOverlap reports whether two MIME types, either of which may be a
+// wildcard, have a type in common
+func mimeOverlap(a, b string) bool {
+	return mimeMatch(a, b) || mimeMatch(b, a)
+}
+
+// typeAccepts reports whether a job type accepts any of the given MIME types.
+// exact is true when the match did not rely on a wildcard. Types that do not
+// advertise any input MIME types accept everything.
+func typeAccepts(t bsubio.ProcessingType, mimeTypes []string) (ok, exact bool) {
+	accepted := typeMimeIn(t)
+	if len(accepted) == 0 {
+		return true, false
+	}
+
+	for _, pattern := range accepted {
+		for _, m := range mimeTypes {
+			if !mimeMatch(pattern, m) {
+				continue
+			}
+			ok = true
+			if !strings.Contains(pattern, "*") {
+				return true, true
 			}
 		}
 	}
 
-	return nil
+	return ok, false
 }
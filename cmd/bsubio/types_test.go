@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/bsubio/bsubio-go"
+)
+
+func TestTypeMatches(t *testing.T) {
+	jobType := func(in, out []string) bsubio.ProcessingType {
+		var pt bsubio.ProcessingType
+		if in != nil {
+			pt.Input = &struct {
+				MimeIn *[]string `json:"mime_in,omitempty"`
+			}{MimeIn: &in}
+		}
+		if out != nil {
+			pt.Output = &struct {
+				Display *string   `json:"display,omitempty"`
+				Ext     *string   `json:"ext,omitempty"`
+				MimeOut *[]string `json:"mime_out,omitempty"`
+			}{MimeOut: &out}
+		}
+		return pt
+	}
+
+	pdf := jobType([]string{"application/pdf"}, []string{"text/plain"})
+	images := jobType([]string{"image/*"}, []string{"application/json"})
+	anything := jobType(nil, nil)
+
+	tests := []struct {
+		name              string
+		jobType           bsubio.ProcessingType
+		accepts, produces string
+		want              bool
+	}{
+		{"no filter", pdf, "", "", true},
+		{"accepts exact", pdf, "application/pdf", "", true},
+		{"accepts other", pdf, "image/png", "", false},
+		{"accepts wildcard type", images, "image/png", "", true},
+		{"accepts wildcard query", images, "image/*", "", true},
+		{"accepts wildcard query other", pdf, "image/*", "", false},
+		{"accepts with parameters", pdf, "application/pdf; charset=binary", "", true},
+		{"produces exact", pdf, "", "text/plain", true},
+		{"produces wildcard", pdf, "", "text/*", true},
+		{"produces other", pdf, "", "application/json", false},
+		{"both", pdf, "application/pdf", "application/json", false},
+		{"no input types accepts anything", anything, "image/png", "", true},
+		{"no output types produces nothing", anything, "", "text/plain", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := typeMatches(tt.jobType, tt.accepts, tt.produces); got != tt.want {
+				t.Errorf("typeMatches(%q, %q) = %v, want %v", tt.accepts, tt.produces, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTypeFields(t *testing.T) {
+	raw := json.RawMessage(`{
+		"type": "pdf/extract",
+		"description": "Extract text",
+		"output": {"mime_out": ["text/plain", "text/markdown"], "ext": "txt"},
+		"input": {"mime_in": ["application/pdf"]},
+		"limits": {"max_size": 10485760, "pages": [1, 2], "beta": false},
+		"options": [{"name": "lang"}],
+		"deprecated": null
+	}`)
+
+	got, err := typeFields(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []typeField{
+		{"Type", "pdf/extract"},
+		{"Description", "Extract text"},
+		{"Accepts", "application/pdf"},
+		{"Produces", "text/plain, text/markdown"},
+		{"Extension", "txt"},
+		{"limits.beta", "false"},
+		{"limits.max_size", "10485760"},
+		{"limits.pages", "1, 2"},
+		{"options", `[{"name":"lang"}]`},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("typeFields() =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestDiffTypes(t *testing.T) {
+	old := []json.RawMessage{
+		json.RawMessage(`{"type": "a", "input": {"mime_in": ["text/plain", "text/html"]}, "output": {"mime_out": ["text/plain"], "ext": "txt"}}`),
+		json.RawMessage(`{"type": "b", "description": "B", "output": {"mime_out": ["application/json"]}}`),
+		json.RawMessage(`{"type": "c", "input": {"mime_in": ["image/*"]}}`),
+		json.RawMessage(`{"type": "d", "input": {"mime_in": ["application/pdf", "image/png"]}}`),
+		json.RawMessage(`{"type": "e", "input": {"mime_in": ["application/pdf"]}, "output": {"mime_out": ["application/*"]}}`),
+		json.RawMessage(`{"type": "f", "input": {"mime_in": ["application/*"]}, "output": {"mime_out": ["text/plain"]}}`),
+		json.RawMessage(`{"type": "gone"}`),
+	}
+	current := []json.RawMessage{
+		json.RawMessage(`{"type": "a", "input": {"mime_in": ["text/plain", "text/markdown"]}, "output": {"mime_out": ["text/plain"], "ext": "md"}}`),
+		json.RawMessage(`{"type": "b", "description": "Better B", "output": {"mime_out": ["application/json", "text/csv"]}, "limits": {"max_size": 1048576}}`),
+		json.RawMessage(`{"type": "c", "input": {"mime_in": ["image/*"]}}`),
+		json.RawMessage(`{"type": "d", "input": {"mime_in": ["application/*", "image/*"]}}`),
+		json.RawMessage(`{"type": "e", "input": {"mime_in": ["*/*"]}, "output": {"mime_out": ["application/json"]}}`),
+		json.RawMessage(`{"type": "f", "input": {"mime_in": ["application/pdf"]}, "output": {"mime_out": ["text/*"]}}`),
+		json.RawMessage(`{"type": "new"}`),
+	}
+
+	changes, err := diffTypes(old, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []typeChange{
+		{Type: "a", Kind: "changed", Breaking: true, Details: []typeChangeDetail{
+			{"no longer accepts text/html", true},
+			{"now accepts text/markdown", false},
+			{`output.ext changed: "txt" -> "md"`, true},
+		}},
+		{Type: "b", Kind: "changed", Breaking: true, Details: []typeChangeDetail{
+			{"now produces text/csv", true},
+			{`description changed: "B" -> "Better B"`, false},
+			{`limits.max_size added: "1048576"`, false},
+		}},
+		// Widening inputs and narrowing outputs break nothing
+		{Type: "d", Kind: "changed", Details: []typeChangeDetail{
+			{"now accepts application/*", false},
+			{"now accepts image/*", false},
+		}},
+		{Type: "e", Kind: "changed", Details: []typeChangeDetail{
+			{"now accepts */*", false},
+			{"no longer produces application/*", false},
+		}},
+		// Narrowing inputs and widening outputs do
+		{Type: "f", Kind: "changed", Breaking: true, Details: []typeChangeDetail{
+			{"no longer accepts application/*", true},
+			{"now produces text/*", true},
+		}},
+		{Type: "gone", Kind: "removed", Breaking: true},
+		{Type: "new", Kind: "added"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("diffTypes() =\n%+v\nwant\n%+v", changes, want)
+	}
+
+	invalid := map[string][]json.RawMessage{
+		"no name":   {json.RawMessage(`{"type": "a"}`), json.RawMessage(`{"description": "nameless"}`)},
+		"empty":     {json.RawMessage(`{"type": ""}`)},
+		"duplicate": {json.RawMessage(`{"type": "a"}`), json.RawMessage(`{"type": "a", "description": "again"}`)},
+	}
+	for name, types := range invalid {
+		if _, err := diffTypes(old, types); err == nil {
+			t.Errorf("diffTypes() with %s type succeeded, want an error", name)
+		}
+		if _, err := diffTypes(types, current); err == nil {
+			t.Errorf("diffTypes() with %s type in the snapshot succeeded, want an error", name)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bsubio/bsubio-go"
+)
+
+// submitJob creates a job, streams data to it and submits it for processing.
+// Unlike the SDK helper it does not buffer the whole input in memory, so it
+// works for stdin and other streams of unknown length. The name and mimeType
+// are passed to the server as the uploaded file's name and content type.
+// The submission is recorded in the job history; inputPath is the file data
+// is read from, or empty for streams such as stdin.
+func submitJob(ctx context.Context, client *bsubio.BsubClient, jobType string, data io.Reader, name, mimeType, inputPath string) (*bsubio.Job, error) {
+	job, err := createJob(ctx, client, jobType)
+	if err != nil {
+		return nil, err
+	}
+
+	// Hash the input while it is uploaded, for the job history
+	hashed := newHashingReader(data)
+
+	// Stream data as multipart form
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+
+	go func() {
+		pw.CloseWithError(writeMultipartFile(writer, hashed, name, mimeType))
+	}()
+
+	uploadResp, err := client.UploadJobDataWithBodyWithResponse(ctx, *job.Id, &bsubio.UploadJobDataParams{
+		Token: *job.UploadToken,
+	}, writer.FormDataContentType(), pr)
+	_ = pr.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload data: %w", err)
+	}
+
+	if uploadResp.StatusCode() != http.StatusOK {
+		return nil, httpErrorf(uploadResp.StatusCode(), "failed to upload data")
+	}
+
+	if err := startJob(ctx, client, *job.Id); err != nil {
+		return nil, err
+	}
+
+	recordSubmission(job, jobType, inputPath, hashed.Sum(), hashed.size)
+
+	return job, nil
+}
+
+// createJob creates a job that is ready to receive its input
+func createJob(ctx context.Context, client *bsubio.BsubClient, jobType string) (*bsubio.Job, error) {
+	createResp, err := client.CreateJobWithResponse(ctx, bsubio.CreateJobJSONRequestBody{
+		Type: jobType,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job: %w", err)
+	}
+
+	if createResp.StatusCode() != http.StatusCreated {
+		return nil, httpErrorf(createResp.StatusCode(), "failed to create job")
+	}
+
+	if createResp.JSON201 == nil || createResp.JSON201.Data == nil {
+		return nil, fmt.Errorf("unexpected response format")
+	}
+
+	job := createResp.JSON201.Data
+	if job.Id == nil || job.UploadToken == nil {
+		return nil, fmt.Errorf("no upload token in response")
+	}
+
+	return job, nil
+}
+
+// startJob submits a job whose input has been uploaded for processing
+func startJob(ctx context.Context, client *bsubio.BsubClient, jobID bsubio.JobId) error {
+	submitResp, err := client.SubmitJobWithResponse(ctx, jobID)
+	if err != nil {
+		return fmt.Errorf("failed to submit job: %w", err)
+	}
+
+	if submitResp.StatusCode() != http.StatusOK {
+		return httpErrorf(submitResp.StatusCode(), "failed to submit job")
+	}
+
+	return nil
+}
+
+// submitFile submits a file from disk, filling in the file name and MIME type
+// from the path when they are not given
+func submitFile(ctx context.Context, client *bsubio.BsubClient, jobType, path, name, mimeType string) (*bsubio.Job, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("input file not found: %s", path)
+		}
+		return nil, fmt.Errorf("failed to access input file: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	if name == "" {
+		name = filepath.Base(path)
+	}
+	if mimeType == "" {
+		mimeType = mime.TypeByExtension(filepath.Ext(name))
+	}
+
+	return submitJob(ctx, client, jobType, file, name, mimeType, path)
+}
+
+// writeMultipartFile writes data as the "file" field of a multipart form
+func writeMultipartFile(writer *multipart.Writer, data io.Reader, name, mimeType string) error {
+	if name == "" {
+		name = "upload"
+	}
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, escapeQuotes(name)))
+	header.Set("Content-Type", mimeType)
+
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return fmt.Errorf("failed to create form file: %w", err)
+	}
+
+	if _, err := io.Copy(part, data); err != nil {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+
+	return writer.Close()
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
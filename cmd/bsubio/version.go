@@ -1,10 +1,66 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"runtime"
 )
 
+// versionInfo describes the CLI and the server it talks to
+type versionInfo struct {
+	CLI         string `json:"cli"`
+	Go          string `json:"go"`
+	OS          string `json:"os"`
+	Arch        string `json:"arch"`
+	Server      string `json:"server,omitempty"`
+	ServerName  string `json:"server_name,omitempty"`
+	ServerBuild string `json:"server_build,omitempty"`
+}
+
+var versionColumns = []outputColumn[versionInfo]{
+	{"cli", func(v versionInfo) string { return v.CLI }},
+	{"go", func(v versionInfo) string { return v.Go }},
+	{"os", func(v versionInfo) string { return v.OS }},
+	{"arch", func(v versionInfo) string { return v.Arch }},
+	{"server", func(v versionInfo) string { return v.Server }},
+	{"server_name", func(v versionInfo) string { return v.ServerName }},
+	{"server_build", func(v versionInfo) string { return v.ServerBuild }},
+}
+
+// cliVersionInfo returns the version information known without asking the
+// server
+func cliVersionInfo() versionInfo {
+	return versionInfo{
+		CLI:  version,
+		Go:   runtime.Version(),
+		OS:   runtime.GOOS,
+		Arch: runtime.GOARCH,
+	}
+}
+
 func runVersion(args []string) error {
+	fs := flag.NewFlagSet("version", flag.ContinueOnError)
+
+	// Define flags
+	out := addOutputFlags(fs)
+
+	// Custom usage function
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bsubio version [options]\n\n")
+		fmt.Fprintf(fs.Output(), "Show CLI and API server versions\n\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	// Parse flags
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	if err := out.check(); err != nil {
+		return err
+	}
+
 	// Create client
 	client, err := createClient()
 	if err != nil {
@@ -20,13 +76,24 @@ func runVersion(args []string) error {
 	}
 
 	if resp.StatusCode() != 200 {
-		return fmt.Errorf("failed to get API version: HTTP %d", resp.StatusCode())
+		return httpErrorf(resp.StatusCode(), "failed to get API version")
+	}
+
+	info := cliVersionInfo()
+	if resp.JSON200 != nil {
+		info.Server = derefString(resp.JSON200.Version)
+		info.ServerName = derefString(resp.JSON200.Server)
+		info.ServerBuild = derefString(resp.JSON200.Build)
+	}
+
+	if !out.table() {
+		return printItem(out, info, versionColumns)
 	}
 
-	fmt.Printf("CLI Version:    %s\n", version)
+	fmt.Printf("CLI Version:    %s\n", info.CLI)
 
-	if resp.JSON200 != nil && resp.JSON200.Version != nil {
-		fmt.Printf("Server Version: %s\n", *resp.JSON200.Version)
+	if info.Server != "" {
+		fmt.Printf("Server Version: %s\n", info.Server)
 	}
 
 	return nil
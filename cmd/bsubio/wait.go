@@ -1,48 +1,111 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/bsubio/bsubio-go"
 	"github.com/google/uuid"
+	"golang.org/x/term"
 )
 
+// waitListThreshold is the number of pending jobs from which statuses are
+// fetched with a single ListJobs call per tick instead of one GetJob each
+const waitListThreshold = 3
+
+// waitListLimit is how many recent jobs are requested from ListJobs. Jobs
+// older than that are still polled one by one.
+const waitListLimit = 500
+
+// waitLiveMax is the largest number of jobs shown with one line each; more
+// jobs are summarized in a single line
+const waitLiveMax = 20
+
+// waitJob tracks one of the jobs being waited for
+type waitJob struct {
+	ID           uuid.UUID
+	Status       string
+	ErrorMessage string
+}
+
+func (j *waitJob) done() bool {
+	return j.Status == string(bsubio.JobStatusFinished) || j.Status == string(bsubio.JobStatusFailed)
+}
+
 func runWait(args []string) error {
 	fs := flag.NewFlagSet("wait", flag.ContinueOnError)
 
 	// Define flags
 	verbose := fs.Bool("v", false, "Verbose output")
-	interval := fs.Int("t", 5, "Polling interval in seconds")
+	interval := fs.Int("t", 0, "Poll at this fixed interval in seconds instead of backing off")
+	maxInterval := fs.Int("max-interval", int(pollMaxDelay/time.Second), "Maximum polling interval in seconds when backing off")
+	all := fs.Bool("all", false, "Wait until every job has completed (default)")
+	anyJob := fs.Bool("any", false, "Wait until any one of the jobs has completed")
+	cancelOnInterrupt := fs.Bool("cancel-on-interrupt", false, "Cancel the jobs still running if waiting is interrupted with Ctrl-C")
 
 	// Custom usage function
 	fs.Usage = func() {
-		fmt.Fprintf(fs.Output(), "Usage: bsubio wait [options] <jobid>\n\n")
-		fmt.Fprintf(fs.Output(), "Wait for a job to complete\n\n")
+		fmt.Fprintf(fs.Output(), "Usage: bsubio wait [options] <jobid> [<jobid>...]\n\n")
+		fmt.Fprintf(fs.Output(), "Wait for one or more jobs to complete\n\n")
 		fmt.Fprintf(fs.Output(), "Options:\n")
 		fs.PrintDefaults()
 		fmt.Fprintf(fs.Output(), "\nArguments:\n")
-		fmt.Fprintf(fs.Output(), "  jobid    Job ID to wait for\n")
+		fmt.Fprintf(fs.Output(), "  jobid    Job IDs (or prefixes, names, @last[~N]) to wait for, or - to read them from stdin\n")
 	}
 
 	// Parse flags
 	if err := fs.Parse(args); err != nil {
-		return err
+		return usageError(err)
 	}
 
-	// Get remaining arguments
+	if *all && *anyJob {
+		return usageErrorf("--all and --any cannot be used together")
+	}
+
+	if *interval < 0 || *maxInterval < 1 {
+		return usageErrorf("polling interval must be at least 1 second")
+	}
+
+	// -t keeps the fixed interval wait always had; without it, polling
+	// backs off up to --max-interval
+	minDelay, maxDelay := pollMinDelay, time.Duration(*maxInterval)*time.Second
+	if *interval > 0 {
+		minDelay = time.Duration(*interval) * time.Second
+		maxDelay = minDelay
+	}
+
+	// Get remaining arguments; without any, job IDs are read from stdin
 	remainingArgs := fs.Args()
-	if len(remainingArgs) != 1 {
-		fs.Usage()
-		return fmt.Errorf("expected 1 argument, got %d", len(remainingArgs))
+	if len(remainingArgs) == 0 {
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			fs.Usage()
+			return usageErrorf("expected at least 1 argument, got 0")
+		}
+		remainingArgs = []string{"-"}
 	}
 
-	jobID := remainingArgs[0]
+	var ids []string
+	for _, arg := range remainingArgs {
+		if arg != "-" {
+			ids = append(ids, arg)
+			continue
+		}
+		stdinIDs, err := readJobIDs(os.Stdin)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, stdinIDs...)
+	}
 
-	jobUUID, err := uuid.Parse(jobID)
-	if err != nil {
-		return fmt.Errorf("invalid job ID: %w", err)
+	if len(ids) == 0 {
+		return usageErrorf("no job IDs given")
 	}
 
 	// Create client
@@ -53,46 +116,314 @@ func runWait(args []string) error {
 
 	ctx := getContext()
 
+	jobIDs, err := resolveJobIDs(ctx, client, ids)
+	if err != nil {
+		return err
+	}
+
+	jobs := make([]*waitJob, 0, len(jobIDs))
+	for _, id := range jobIDs {
+		jobs = append(jobs, &waitJob{ID: id})
+	}
+
 	// Poll for job completion
 	if *verbose {
-		fmt.Fprintf(os.Stderr, "Waiting for job %s to complete (polling every %d seconds)...\n", jobID, *interval)
+		if *interval > 0 {
+			fmt.Fprintf(os.Stderr, "Waiting for %d job(s) to complete (polling every %d seconds)...\n", len(jobs), *interval)
+		} else {
+			fmt.Fprintf(os.Stderr, "Waiting for %d job(s) to complete (polling at most every %d seconds)...\n", len(jobs), *maxInterval)
+		}
 	}
 
+	display := newWaitDisplay(*verbose)
+	backoff := newPollBackoff(pollClock, minDelay, maxDelay)
+
+	var completed *waitJob
 	for {
-		resp, err := client.GetJobWithResponse(ctx, jobUUID)
+		changed, err := pollWaitJobs(ctx, client, jobs, backoff)
+
+		var throttled *throttledError
+		if errors.As(err, &throttled) {
+			if err := pollSleep(ctx, backoff.Throttled(throttled.RetryAfter)); err != nil {
+				handleInterruptedWait(client, *cancelOnInterrupt, pendingJobIDs(jobs)...)
+				return err
+			}
+			continue
+		}
 		if err != nil {
-			return fmt.Errorf("failed to get job status: %w", err)
+			handleInterruptedWait(client, *cancelOnInterrupt, pendingJobIDs(jobs)...)
+			return err
 		}
+		display.update(jobs, changed)
 
-		if resp.StatusCode() != 200 {
-			return fmt.Errorf("failed to get job status: HTTP %d", resp.StatusCode())
+		pending := 0
+		for _, j := range jobs {
+			if !j.done() {
+				pending++
+			} else if *anyJob && completed == nil {
+				completed = j
+			}
+		}
+
+		if completed != nil || pending == 0 {
+			break
+		}
+
+		if err := pollSleep(ctx, backoff.Next()); err != nil {
+			handleInterruptedWait(client, *cancelOnInterrupt, pendingJobIDs(jobs)...)
+			return err
+		}
+	}
+
+	// With --any, the first job to complete decides the result
+	if completed != nil {
+		fmt.Printf("%s %s\n", completed.ID, completed.Status)
+		if completed.Status == string(bsubio.JobStatusFailed) {
+			return waitJobError(completed)
+		}
+		fmt.Fprintf(os.Stderr, "Job %s completed successfully\n", completed.ID)
+		return nil
+	}
+
+	// A single job keeps stdout empty, as it always did; the exit status
+	// tells how it ended
+	if len(jobs) == 1 {
+		if jobs[0].Status == string(bsubio.JobStatusFailed) {
+			return waitJobError(jobs[0])
+		}
+		fmt.Fprintf(os.Stderr, "Job completed successfully\n")
+		return nil
+	}
+
+	failed := 0
+	for _, j := range jobs {
+		fmt.Printf("%s %s\n", j.ID, j.Status)
+		if j.Status == string(bsubio.JobStatusFailed) {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return errorf(kindJobFailed, "%d of %d job(s) failed", failed, len(jobs))
+	}
+
+	fmt.Fprintf(os.Stderr, "All %d jobs completed successfully\n", len(jobs))
+	return nil
+}
+
+// pendingJobIDs returns the IDs of the jobs that have not completed
+func pendingJobIDs(jobs []*waitJob) []bsubio.JobId {
+	var ids []bsubio.JobId
+	for _, j := range jobs {
+		if !j.done() {
+			ids = append(ids, j.ID)
 		}
+	}
+	return ids
+}
 
-		if resp.JSON200 == nil || resp.JSON200.Data == nil {
-			return fmt.Errorf("unexpected response format")
+// waitJobError describes a failed job
+func waitJobError(j *waitJob) error {
+	err := fmt.Errorf("job %s failed", j.ID)
+	if j.ErrorMessage != "" {
+		err = fmt.Errorf("job %s failed: %s", j.ID, j.ErrorMessage)
+	}
+	return &cliError{Kind: kindJobFailed, JobID: j.ID.String(), Err: err}
+}
+
+// readJobIDs reads whitespace separated job IDs, skipping lines starting with #
+func readJobIDs(r io.Reader) ([]string, error) {
+	var ids []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
 		}
+		ids = append(ids, strings.Fields(line)...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read job IDs: %w", err)
+	}
 
-		job := resp.JSON200.Data
+	return ids, nil
+}
 
-		if *verbose && job.Status != nil {
-			fmt.Fprintf(os.Stderr, "Status: %s\n", *job.Status)
+// pollWaitJobs refreshes the status of every job that has not completed and
+// returns the jobs whose status changed. When many jobs are pending, their
+// statuses come from a single ListJobs call; only jobs missing from it are
+// fetched one by one. The first time a job is seen running, the backoff is
+// told when it is expected to finish.
+func pollWaitJobs(ctx context.Context, client *bsubio.BsubClient, jobs []*waitJob, backoff *pollBackoff) ([]*waitJob, error) {
+	var pending []*waitJob
+	for _, j := range jobs {
+		if !j.done() {
+			pending = append(pending, j)
 		}
+	}
 
-		// Check if job is in a terminal state
+	var changed []*waitJob
+	update := func(j *waitJob, job *bsubio.Job) {
+		status := ""
 		if job.Status != nil {
-			switch *job.Status {
-			case "finished":
-				fmt.Fprintf(os.Stderr, "Job completed successfully\n")
-				return nil
-			case "failed":
-				if job.ErrorMessage != nil {
-					return fmt.Errorf("job failed: %s", *job.ErrorMessage)
-				}
-				return fmt.Errorf("job failed")
+			status = string(*job.Status)
+		}
+		if status == j.Status {
+			return
+		}
+
+		if j.Status == "" {
+			if t, ok := expectedFinish(job); ok {
+				backoff.Expect(t)
+			}
+		}
+
+		j.Status = status
+		j.ErrorMessage = derefString(job.ErrorMessage)
+		changed = append(changed, j)
+		if j.done() {
+			recordJobStatus(job)
+			recordJobDuration(job)
+		}
+	}
+
+	if len(pending) >= waitListThreshold {
+		listed, err := listJobsByID(ctx, client, waitListLimit)
+		if err != nil {
+			return nil, err
+		}
+
+		var unlisted []*waitJob
+		for _, j := range pending {
+			if job, ok := listed[j.ID]; ok {
+				update(j, job)
+			} else {
+				unlisted = append(unlisted, j)
 			}
 		}
+		pending = unlisted
+	}
+
+	for _, j := range pending {
+		job, err := getJob(ctx, client, j.ID)
+		if err != nil {
+			return nil, err
+		}
+		update(j, job)
+	}
+
+	return changed, nil
+}
+
+// getJob fetches a single job
+func getJob(ctx context.Context, client *bsubio.BsubClient, jobID bsubio.JobId) (*bsubio.Job, error) {
+	resp, err := client.GetJobWithResponse(ctx, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job status: %w", err)
+	}
+
+	if err := checkThrottled(resp.HTTPResponse); err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() != 200 {
+		return nil, httpErrorf(resp.StatusCode(), "failed to get status of job %s", jobID)
+	}
+
+	if resp.JSON200 == nil || resp.JSON200.Data == nil {
+		return nil, fmt.Errorf("unexpected response format")
+	}
+
+	return resp.JSON200.Data, nil
+}
+
+// listJobsByID fetches the most recent jobs, indexed by job ID
+func listJobsByID(ctx context.Context, client *bsubio.BsubClient, limit int) (map[uuid.UUID]*bsubio.Job, error) {
+	resp, err := client.ListJobsWithResponse(ctx, &bsubio.ListJobsParams{
+		Limit: &limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+
+	if err := checkThrottled(resp.HTTPResponse); err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() != 200 {
+		return nil, httpErrorf(resp.StatusCode(), "failed to list jobs")
+	}
+
+	if resp.JSON200 == nil || resp.JSON200.Data == nil || resp.JSON200.Data.Jobs == nil {
+		return nil, fmt.Errorf("unexpected response format")
+	}
+
+	jobs := make(map[uuid.UUID]*bsubio.Job)
+	for i := range *resp.JSON200.Data.Jobs {
+		job := &(*resp.JSON200.Data.Jobs)[i]
+		if job.Id != nil {
+			jobs[*job.Id] = job
+		}
+	}
+
+	return jobs, nil
+}
+
+// waitDisplay shows the status of the jobs being waited for on stderr. On a
+// terminal it keeps one live line per job; otherwise status changes are
+// printed as they happen when verbose output is enabled.
+type waitDisplay struct {
+	live    bool
+	verbose bool
+	lines   int
+}
+
+func newWaitDisplay(verbose bool) *waitDisplay {
+	return &waitDisplay{
+		live:    term.IsTerminal(int(os.Stderr.Fd())),
+		verbose: verbose,
+	}
+}
+
+func (d *waitDisplay) update(jobs []*waitJob, changed []*waitJob) {
+	if !d.live {
+		if !d.verbose {
+			return
+		}
+		for _, j := range changed {
+			if len(jobs) == 1 {
+				fmt.Fprintf(os.Stderr, "Status: %s\n", j.Status)
+			} else {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", j.ID, j.Status)
+			}
+		}
+		return
+	}
+
+	// Move back up over the previous lines and redraw them
+	if d.lines > 0 {
+		fmt.Fprintf(os.Stderr, "\033[%dA", d.lines)
+	}
+
+	if len(jobs) > waitLiveMax {
+		var finished, failed int
+		for _, j := range jobs {
+			switch j.Status {
+			case string(bsubio.JobStatusFinished):
+				finished++
+			case string(bsubio.JobStatusFailed):
+				failed++
+			}
+		}
+		fmt.Fprintf(os.Stderr, "\033[2K%d jobs: %d finished, %d failed, %d pending\n",
+			len(jobs), finished, failed, len(jobs)-finished-failed)
+		d.lines = 1
+		return
+	}
 
-		// Wait before polling again
-		time.Sleep(time.Duration(*interval) * time.Second)
+	for _, j := range jobs {
+		fmt.Fprintf(os.Stderr, "\033[2K%s  %s\n", j.ID, j.Status)
 	}
+	d.lines = len(jobs)
 }
@@ -0,0 +1,454 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bsubio/bsubio-go"
+	"github.com/fsnotify/fsnotify"
+	"github.com/google/uuid"
+)
+
+// watchState records every file the watch command has submitted, keyed by
+// the SHA-256 of its contents, so a restarted watcher neither resubmits
+// finished inputs nor loses track of jobs that were still running
+type watchState struct {
+	Files map[string]watchStateEntry `json:"files"`
+}
+
+type watchStateEntry struct {
+	File      string    `json:"file"`
+	JobID     string    `json:"job_id"`
+	Status    string    `json:"status"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+const watchStateFile = ".bsubio-watch.json"
+
+// watcher processes the files dropped into a directory
+type watcher struct {
+	client  *bsubio.BsubClient
+	jobType string
+	dir     string
+	outDir  string
+	ext     string
+
+	mu        sync.Mutex
+	state     *watchState
+	statePath string
+}
+
+func runWatch(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+
+	// Define flags
+	jobType := fs.String("type", "", "Job type to submit new files as (required)")
+	outDir := fs.String("out", "", "Directory for outputs and logs (default: <dir>/results)")
+	pattern := fs.String("pattern", "*", "Only pick up files matching this pattern (e.g., *.pdf)")
+	concurrency := fs.Int("concurrency", 2, "Number of files to process in parallel")
+	settle := fs.Duration("settle", 2*time.Second, "How long a file must stay unchanged before it is submitted")
+
+	// Custom usage function
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bsubio watch [options] <dir>\n\n")
+		fmt.Fprintf(fs.Output(), "Watch a directory and submit every new file as a job\n\n")
+		fmt.Fprintf(fs.Output(), "Files already processed are skipped, except failed ones, which are\n")
+		fmt.Fprintf(fs.Output(), "submitted again when dropped into the directory again.\n\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "\nArguments:\n")
+		fmt.Fprintf(fs.Output(), "  dir    Directory to watch\n")
+	}
+
+	// Parse flags
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	// Get remaining arguments
+	remainingArgs := fs.Args()
+	if len(remainingArgs) != 1 {
+		fs.Usage()
+		return usageErrorf("expected 1 argument, got %d", len(remainingArgs))
+	}
+
+	if *jobType == "" {
+		fs.Usage()
+		return usageErrorf("--type is required")
+	}
+
+	if *concurrency < 1 {
+		return usageErrorf("concurrency must be at least 1")
+	}
+
+	if _, err := filepath.Match(*pattern, ""); err != nil {
+		return usageErrorf("invalid pattern %q: %w", *pattern, err)
+	}
+
+	dir := remainingArgs[0]
+	info, err := os.Stat(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("directory not found: %s", dir)
+		}
+		return fmt.Errorf("failed to access directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("not a directory: %s", dir)
+	}
+
+	if *outDir == "" {
+		*outDir = filepath.Join(dir, "results")
+	}
+
+	for _, d := range []string{*outDir, filepath.Join(dir, "done"), filepath.Join(dir, "failed")} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+	}
+
+	statePath := filepath.Join(dir, watchStateFile)
+	state, err := loadWatchState(statePath)
+	if err != nil {
+		return err
+	}
+
+	// Create client
+	client, err := createClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := getContext()
+
+	w := &watcher{
+		client:    client,
+		jobType:   *jobType,
+		dir:       dir,
+		outDir:    *outDir,
+		ext:       outputExtension(ctx, client, *jobType),
+		state:     state,
+		statePath: statePath,
+	}
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to start watching: %w", err)
+	}
+	defer func() {
+		_ = fsw.Close()
+	}()
+
+	if err := fsw.Add(dir); err != nil {
+		return fmt.Errorf("failed to watch %s: %w", dir, err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Watching %s for new files (type %s, outputs in %s)\n", dir, *jobType, *outDir)
+	fmt.Fprintf(os.Stderr, "Press Ctrl-C to stop\n")
+
+	work := make(chan string)
+	finished := make(chan string)
+
+	var wg sync.WaitGroup
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range work {
+				w.process(ctx, path)
+				select {
+				case finished <- path:
+				case <-ctx.Done():
+				}
+			}
+		}()
+	}
+
+	// Files are submitted once they have not changed for the settle period;
+	// seen holds the time of the last change, queued the files being worked on
+	seen := make(map[string]time.Time)
+	queued := make(map[string]bool)
+
+	consider := func(path string) {
+		if queued[path] || !w.wants(path, *pattern) {
+			return
+		}
+		seen[path] = time.Now()
+	}
+
+	// Pick up files that arrived while the watcher was not running
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read directory: %w", err)
+	}
+	for _, e := range entries {
+		consider(filepath.Join(dir, e.Name()))
+	}
+
+	ticker := time.NewTicker(settleCheckInterval(*settle))
+	defer ticker.Stop()
+
+	var ready []string
+	for {
+		var next chan string
+		var nextPath string
+		if len(ready) > 0 {
+			next = work
+			nextPath = ready[0]
+		}
+
+		select {
+		case <-ctx.Done():
+			fmt.Fprintf(os.Stderr, "Shutting down, unfinished jobs will be picked up again on the next start\n")
+			close(work)
+			wg.Wait()
+			return nil
+
+		case event, ok := <-fsw.Events:
+			if !ok {
+				return fmt.Errorf("file watcher stopped")
+			}
+			if event.Has(fsnotify.Create) || event.Has(fsnotify.Write) {
+				consider(event.Name)
+			}
+			if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+				delete(seen, event.Name)
+			}
+
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return fmt.Errorf("file watcher stopped")
+			}
+			fmt.Fprintf(os.Stderr, "Watch error: %v\n", err)
+
+		case <-ticker.C:
+			for path, last := range seen {
+				if time.Since(last) < *settle {
+					continue
+				}
+				delete(seen, path)
+				queued[path] = true
+				ready = append(ready, path)
+			}
+
+		case next <- nextPath:
+			ready = ready[1:]
+
+		case path := <-finished:
+			delete(queued, path)
+		}
+	}
+}
+
+// settleCheckInterval returns how often to look for files that have settled
+func settleCheckInterval(settle time.Duration) time.Duration {
+	interval := settle / 4
+	if interval < 100*time.Millisecond {
+		interval = 100 * time.Millisecond
+	}
+	return interval
+}
+
+// wants reports whether a path is a regular file that should be submitted
+func (w *watcher) wants(path, pattern string) bool {
+	name := filepath.Base(path)
+	if filepath.Dir(path) != filepath.Clean(w.dir) || strings.HasPrefix(name, ".") {
+		return false
+	}
+
+	if ok, _ := filepath.Match(pattern, name); !ok {
+		return false
+	}
+
+	info, err := os.Lstat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// process submits a file, waits for its job, saves the output and logs, and
+// moves the file into done/ or failed/. A file whose job was interrupted by
+// a shutdown is left in place and resumed on the next start. A file that
+// was processed before is not submitted again, unless it failed.
+func (w *watcher) process(ctx context.Context, path string) {
+	name := filepath.Base(path)
+
+	hash, err := hashFile(path)
+	if err != nil {
+		// The file was removed or renamed before it could be submitted
+		if !fileExists(path) {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		w.moveInput(path, "failed")
+		return
+	}
+
+	w.mu.Lock()
+	prev, known := w.state.Files[hash]
+	w.mu.Unlock()
+
+	// Failed files only come back when dropped in again, to be retried
+	var jobID bsubio.JobId
+	switch {
+	case known && prev.Status == "finished":
+		fmt.Fprintf(os.Stderr, "%s: already processed as job %s\n", name, prev.JobID)
+		w.moveInput(path, "done")
+		return
+
+	case known && prev.Status == "failed":
+		if prev.JobID != "" {
+			fmt.Fprintf(os.Stderr, "%s: retrying, job %s failed\n", name, prev.JobID)
+		} else {
+			fmt.Fprintf(os.Stderr, "%s: retrying\n", name)
+		}
+
+	case known && prev.JobID != "":
+		if id, err := uuid.Parse(prev.JobID); err == nil {
+			jobID = id
+			fmt.Fprintf(os.Stderr, "%s: resuming job %s\n", name, jobID)
+		}
+	}
+
+	if jobID == uuid.Nil {
+		job, err := submitFile(ctx, w.client, w.jobType, path, "", "")
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			w.record(hash, name, "", "failed")
+			w.moveInput(path, "failed")
+			return
+		}
+		jobID = *job.Id
+		w.record(hash, name, jobID.String(), "submitted")
+		fmt.Fprintf(os.Stderr, "%s: submitted as job %s\n", name, jobID)
+	}
+
+	finishedJob, err := waitForJob(ctx, w.client, jobID)
+	if err != nil {
+		if ctx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "%s: failed to wait for job %s: %v\n", name, jobID, err)
+		}
+		// Leave the file in place so the job is resumed on the next start
+		return
+	}
+	recordJobStatus(finishedJob)
+
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	if err := writeJobLogs(ctx, w.client, jobID, filepath.Join(w.outDir, base+".log")); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+	}
+
+	status := "finished"
+	if finishedJob.Status != nil && *finishedJob.Status == bsubio.JobStatusFailed {
+		status = "failed"
+		if finishedJob.ErrorMessage != nil {
+			fmt.Fprintf(os.Stderr, "%s: job %s failed: %s\n", name, jobID, *finishedJob.ErrorMessage)
+		} else {
+			fmt.Fprintf(os.Stderr, "%s: job %s failed\n", name, jobID)
+		}
+	} else {
+		outPath := filepath.Join(w.outDir, base+"."+w.ext)
+		if err := writeJobOutput(ctx, w.client, jobID, outPath); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			status = "failed"
+		} else {
+			fmt.Fprintf(os.Stderr, "%s: finished, output saved to %s\n", name, outPath)
+		}
+	}
+
+	w.record(hash, name, jobID.String(), status)
+	w.moveInput(path, dirForStatus(status))
+}
+
+// record updates the state of a file and saves the state file
+func (w *watcher) record(hash, name, jobID, status string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.state.Files[hash] = watchStateEntry{
+		File:      name,
+		JobID:     jobID,
+		Status:    status,
+		UpdatedAt: time.Now(),
+	}
+
+	if err := saveWatchState(w.statePath, w.state); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+// moveInput moves a processed file into a subdirectory of the watched
+// directory, adding a timestamp to its name if the name is already taken
+func (w *watcher) moveInput(path, subdir string) {
+	name := filepath.Base(path)
+	dest := filepath.Join(w.dir, subdir, name)
+
+	if _, err := os.Lstat(dest); err == nil {
+		ext := filepath.Ext(name)
+		dest = filepath.Join(w.dir, subdir, fmt.Sprintf("%s-%s%s", strings.TrimSuffix(name, ext), time.Now().Format("20060102-150405"), ext))
+	}
+
+	if err := os.Rename(path, dest); err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "%s: failed to move to %s: %v\n", name, subdir, err)
+	}
+}
+
+func dirForStatus(status string) string {
+	if status == "finished" {
+		return "done"
+	}
+	return "failed"
+}
+
+func loadWatchState(path string) (*watchState, error) {
+	state := &watchState{Files: make(map[string]watchStateEntry)}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to read watch state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse watch state %s: %w", path, err)
+	}
+	if state.Files == nil {
+		state.Files = make(map[string]watchStateEntry)
+	}
+
+	return state, nil
+}
+
+// saveWatchState writes the state file atomically, so that a watcher killed
+// while saving never leaves a truncated file behind
+func saveWatchState(path string, state *watchState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal watch state: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write watch state: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write watch state: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bsubio/bsubio-go"
+	"github.com/google/uuid"
+)
+
+func TestWatchRetriesFailedFile(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	// Jobs fail until the server is told otherwise
+	var created atomic.Int32
+	var status atomic.Value
+	status.Store(string(bsubio.JobStatusFailed))
+	id := uuid.New()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/jobs"):
+			created.Add(1)
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"success": true, "data": {"id": %q, "upload_token": "token", "status": "created"}}`, id)
+		case strings.Contains(r.URL.Path, "/upload/"), strings.HasSuffix(r.URL.Path, "/submit"):
+			_, _ = fmt.Fprint(w, `{"success": true}`)
+		case strings.HasSuffix(r.URL.Path, "/output"), strings.HasSuffix(r.URL.Path, "/logs"):
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = fmt.Fprint(w, "output")
+		default:
+			fmt.Fprintf(w, `{"success": true, "data": {"id": %q, "status": %q}}`, id, status.Load())
+		}
+	}))
+	defer srv.Close()
+
+	client, err := bsubio.NewBsubClient(bsubio.Config{APIKey: "test", BaseURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	for _, d := range []string{"results", "done", "failed"} {
+		if err := os.Mkdir(filepath.Join(dir, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w := &watcher{
+		client:    client,
+		jobType:   "passthru",
+		dir:       dir,
+		outDir:    filepath.Join(dir, "results"),
+		ext:       "txt",
+		state:     &watchState{Files: make(map[string]watchStateEntry)},
+		statePath: filepath.Join(dir, watchStateFile),
+	}
+
+	input := filepath.Join(dir, "scan.pdf")
+	drop := func() {
+		t.Helper()
+		if err := os.WriteFile(input, []byte("scan"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	drop()
+	w.process(context.Background(), input)
+	if !fileExists(filepath.Join(dir, "failed", "scan.pdf")) {
+		t.Fatalf("failed input was not moved into failed/")
+	}
+
+	// Dropped in again, the file is submitted again
+	status.Store(string(bsubio.JobStatusFinished))
+	drop()
+	w.process(context.Background(), input)
+	if n := created.Load(); n != 2 {
+		t.Errorf("%d job(s) created, want 2", n)
+	}
+	if !fileExists(filepath.Join(dir, "done", "scan.pdf")) {
+		t.Errorf("retried input was not moved into done/")
+	}
+	if !fileExists(filepath.Join(dir, "results", "scan.txt")) {
+		t.Errorf("output of the retried input was not saved")
+	}
+
+	// Once it finished, it is not submitted again
+	drop()
+	w.process(context.Background(), input)
+	if n := created.Load(); n != 2 {
+		t.Errorf("%d job(s) created, want 2", n)
+	}
+	if fileExists(input) {
+		t.Errorf("processed input was left in place")
+	}
+
+	state, err := loadWatchState(w.statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Files) != 1 {
+		t.Fatalf("state holds %d files, want 1", len(state.Files))
+	}
+	for _, e := range state.Files {
+		if e.Status != "finished" {
+			t.Errorf("state records %q, want finished", e.Status)
+		}
+	}
+}
@@ -4,8 +4,10 @@ go 1.25.0
 
 require (
 	github.com/bsubio/bsubio-go v0.0.0-20251114014420-b075c19a7a28
+	github.com/fsnotify/fsnotify v1.10.1
 	github.com/google/uuid v1.6.0
 	golang.org/x/term v0.36.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (